@@ -15,12 +15,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcping/internal/config"
 	"github.com/GoogleCloudPlatform/gcping/internal/httphandler"
+	"github.com/GoogleCloudPlatform/gcping/internal/udpecho"
+	"github.com/quic-go/quic-go/http3"
 )
 
 func main() {
@@ -28,7 +38,6 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
-	log.Printf("Serving on :%s", port)
 
 	region := os.Getenv("REGION")
 	if region == "" {
@@ -42,14 +51,108 @@ func main() {
 		kdp = "/var/run/ko/"
 	}
 
-	handler := httphandler.New(&httphandler.Options{
+	// Serve Prometheus metrics on /metrics if METRICS is true.
+	metrics, _ := strconv.ParseBool(os.Getenv("METRICS"))
+	// Serve /api/download and /api/upload if THROUGHPUT is true.
+	throughput, _ := strconv.ParseBool(os.Getenv("THROUGHPUT"))
+
+	// Wait up to SHUTDOWN_TIMEOUT for in-flight requests on shutdown. Cloud
+	// Run allows 10s after SIGTERM.
+	shutdownTimeout := 10 * time.Second
+	if s := os.Getenv("SHUTDOWN_TIMEOUT"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			log.Fatalf("Invalid SHUTDOWN_TIMEOUT: %v", err)
+		}
+		shutdownTimeout = d
+	}
+
+	var handler http.Handler = httphandler.New(&httphandler.Options{
 		Region:     region,
 		StaticRoot: http.Dir(kdp),
 		Endpoints:  config.AllEndpoints,
+		Metrics:    metrics,
+		GRPC:       true,
+		Throughput: throughput,
 	})
+	// Write an access log entry per request to stdout if ACCESS_LOG is true.
+	if accessLog, _ := strconv.ParseBool(os.Getenv("ACCESS_LOG")); accessLog {
+		handler = httphandler.AccessLog(handler, os.Stdout)
+	}
+
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: handler,
+	}
+	// Accept HTTP/2 without TLS (h2c) next to HTTP/1.1, for gRPC.
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
 
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("ListenAndServe(): %v", err)
+	// Serve TLS instead if TLS_CERT and TLS_KEY are set, with HTTP/3 on the
+	// UDP port of the same number. Cloud Run terminates TLS itself.
+	certFile, keyFile := os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY")
+	var h3 *http3.Server
+	if certFile != "" && keyFile != "" {
+		srv.Protocols.SetHTTP2(true)
+		h3 = &http3.Server{
+			Addr:    ":" + port,
+			Handler: handler,
+		}
+		go func() {
+			log.Printf("Serving HTTP/3 on udp :%s", port)
+			if err := h3.ListenAndServeTLS(certFile, keyFile); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("http3 ListenAndServeTLS(): %v", err)
+			}
+		}()
+	}
+	go func() {
+		log.Printf("Serving on :%s", port)
+		var err error
+		if h3 != nil {
+			err = srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("ListenAndServe(): %v", err)
+		}
+	}()
+
+	// Echo UDP packets on UDP_PORT if set.
+	if udpPort := os.Getenv("UDP_PORT"); udpPort != "" {
+		pc, err := net.ListenPacket("udp", ":"+udpPort)
+		if err != nil {
+			log.Fatalf("ListenPacket(): %v", err)
+		}
+		defer pc.Close()
+		go func() {
+			log.Printf("Echoing UDP on :%s", udpPort)
+			if err := udpecho.Serve(pc); !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("udpecho.Serve(): %v", err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	log.Printf("Shutting down, waiting up to %v for requests in flight.", shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	if h3 != nil {
+		wg.Go(func() {
+			if err := h3.Shutdown(ctx); err != nil {
+				log.Printf("http3 Shutdown(): %v", err)
+			}
+		})
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown(): %v", err)
 	}
+	wg.Wait()
 	log.Print("Exiting.")
 }
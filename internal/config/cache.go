@@ -0,0 +1,156 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache keeps the Endpoint map fetched from a server on disk, so that it
+// isn't downloaded on every run of the cli.
+type Cache struct {
+	// Dir is the directory where cached maps are stored.
+	Dir string
+	// TTL is how long a cached map is used before it is revalidated with
+	// the server.
+	TTL time.Duration
+}
+
+// cacheEntry is the on-disk format of a cached map.
+type cacheEntry struct {
+	URL          string
+	ETag         string
+	LastModified string
+	Fetched      time.Time
+	Endpoints    map[string]Endpoint
+}
+
+// EndpointsFromServer is like the package level EndpointsFromServer, but
+// returns the cached map if it is younger than TTL. Older maps are
+// revalidated with a conditional request, and still returned if that
+// fails, e.g. when offline. Failures to read or write the cache are
+// ignored.
+func (c *Cache) EndpointsFromServer(ctx context.Context, endpointsURL string) (map[string]Endpoint, error) {
+	name := c.path(endpointsURL)
+	cached, _ := readCacheEntry(name)
+	if cached != nil && cached.URL != endpointsURL {
+		cached = nil
+	}
+	if cached != nil && time.Since(cached.Fetched) < c.TTL {
+		return cached.Endpoints, nil
+	}
+	e, err := c.fetch(ctx, endpointsURL, name, cached)
+	if err != nil && cached != nil {
+		return cached.Endpoints, nil
+	}
+	return e, err
+}
+
+// fetch downloads the map at endpointsURL, revalidating cached if it is not
+// nil, and stores it in the cache file name.
+func (c *Cache) fetch(ctx context.Context, endpointsURL, name string, cached *cacheEntry) (map[string]Endpoint, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		endpointsURL,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		cached.Fetched = time.Now()
+		writeCacheEntry(name, cached)
+		return cached.Endpoints, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%v %s", resp.Status, endpointsURL)
+	}
+
+	e, err := decodeEndpoints(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	writeCacheEntry(name, &cacheEntry{
+		URL:          endpointsURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+		Endpoints:    e,
+	})
+	return e, nil
+}
+
+// path returns the cache file of endpointsURL.
+func (c *Cache) path(endpointsURL string) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("endpoints-%x.json", sha256.Sum256([]byte(endpointsURL))))
+}
+
+func readCacheEntry(name string) (*cacheEntry, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// writeCacheEntry atomically replaces the cache file name with e.
+func writeCacheEntry(name string, e *cacheEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
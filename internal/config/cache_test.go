@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCache(t *testing.T) {
+	const (
+		body = `{"test-region":{"URL":"https://test-region","Region":"test-region","RegionName":"Test Region"}}`
+		etag = `"v1"`
+	)
+	want := map[string]Endpoint{
+		"test-region": {
+			URL:        "https://test-region",
+			Region:     "test-region",
+			RegionName: "Test Region",
+		},
+	}
+
+	var (
+		mu    sync.Mutex
+		codes []int
+	)
+	var fakeHandler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		code := http.StatusOK
+		if r.Header.Get("If-None-Match") == etag {
+			code = http.StatusNotModified
+		}
+		mu.Lock()
+		codes = append(codes, code)
+		mu.Unlock()
+
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(code)
+		if code == http.StatusOK {
+			io.WriteString(w, body)
+		}
+	}
+	ts := httptest.NewServer(fakeHandler)
+	t.Cleanup(ts.Close)
+
+	dir := t.TempDir()
+	testCases := []struct {
+		name      string
+		ttl       time.Duration
+		wantCodes []int
+	}{
+		{"empty cache", time.Hour, []int{http.StatusOK}},
+		{"fresh cache", time.Hour, []int{http.StatusOK}},
+		{"expired cache", 0, []int{http.StatusOK, http.StatusNotModified}},
+	}
+	// Test cases share the cache directory and run in order.
+	for _, tc := range testCases {
+		c := &Cache{Dir: dir, TTL: tc.ttl}
+		got, err := c.EndpointsFromServer(context.Background(), ts.URL)
+		if err != nil {
+			t.Fatalf("%s: EndpointsFromServer() failed: %v", tc.name, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: EndpointsFromServer() = (-want, +got):\n%s", tc.name, diff)
+		}
+		mu.Lock()
+		if diff := cmp.Diff(tc.wantCodes, codes); diff != "" {
+			t.Errorf("%s: server responses (-want, +got):\n%s", tc.name, diff)
+		}
+		mu.Unlock()
+	}
+
+	// An expired cache is still used if the server can't be reached.
+	ts.Close()
+	c := &Cache{Dir: dir, TTL: 0}
+	got, err := c.EndpointsFromServer(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("server down: EndpointsFromServer() failed: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("server down: EndpointsFromServer() = (-want, +got):\n%s", diff)
+	}
+	// Without a cache, the error is returned.
+	c = &Cache{Dir: t.TempDir(), TTL: 0}
+	if _, err := c.EndpointsFromServer(context.Background(), ts.URL); err == nil {
+		t.Error("server down, empty cache: EndpointsFromServer() succeeded, want error")
+	}
+}
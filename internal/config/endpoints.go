@@ -18,7 +18,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 )
 
 // Endpoint represents a Cloud Run service deploy in a particular region.
@@ -30,6 +32,10 @@ type Endpoint struct {
 	Region string
 	// RegionName is the geographic name of the region, e.g., Iowa.
 	RegionName string
+	// GRPCURL is the HTTPS URL of a service in the same region with
+	// HTTP/2 end to end, which gRPC needs. It is empty if the region has
+	// none.
+	GRPCURL string `json:",omitempty"`
 }
 
 // TODO: clean up after PR#138 is merged and tested https://github.com/GoogleCloudPlatform/gcping/pull/138
@@ -56,13 +62,32 @@ func EndpointsFromServer(ctx context.Context, endpointsURL string) (map[string]E
 		return nil, fmt.Errorf("%v %s", resp.Status, endpointsURL)
 	}
 
+	return decodeEndpoints(resp.Body)
+}
+
+// EndpointsFromFile is used by the cli to read an Endpoint map from a file
+// in the same JSON format served by the gcping endpoints.
+func EndpointsFromFile(name string) (map[string]Endpoint, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	e, err := decodeEndpoints(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return e, nil
+}
+
+func decodeEndpoints(r io.Reader) (map[string]Endpoint, error) {
 	e := make(map[string]Endpoint)
-	decoder := json.NewDecoder(resp.Body)
+	decoder := json.NewDecoder(r)
 	if err := decoder.Decode(&e); err != nil {
 		return nil, err
 	}
-
-	return e, err
+	return e, nil
 }
 
 // AllEndpoints associates a region name with its Cloud Run Endpoint.
@@ -19,6 +19,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -104,3 +106,61 @@ func TestEndpointsFromServer(t *testing.T) {
 		})
 	}
 }
+
+func TestEndpointsFromFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		body    string
+		wantErr bool
+		want    map[string]Endpoint
+	}{
+		{
+			name:    "valid",
+			body:    `{"test-region":{"URL":"https://test-region","Region":"test-region","RegionName":"Test Region"}}`,
+			wantErr: false,
+			want: map[string]Endpoint{
+				"test-region": {
+					URL:        "https://test-region",
+					Region:     "test-region",
+					RegionName: "Test Region",
+				},
+			},
+		},
+		{
+			name:    "empty file",
+			wantErr: true,
+		},
+		{
+			name:    "syntax error",
+			body:    "invalid",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			name := filepath.Join(t.TempDir(), "endpoints.json")
+			if err := os.WriteFile(name, []byte(tc.body), 0644); err != nil {
+				t.Fatalf("WriteFile() failed: %v", err)
+			}
+			got, err := EndpointsFromFile(name)
+			if got := (err != nil); got != tc.wantErr {
+				t.Errorf("EndpointsFromFile(): got error %v, want %v", got, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("EndpointsFromFile() = (-want, +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := EndpointsFromFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Errorf("EndpointsFromFile(): got no error for a missing file")
+		}
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Continents groups region prefixes, the part of a region name before the
+// first dash, by continent.
+var Continents = map[string][]string{
+	"africa":     {"africa"},
+	"americas":   {"northamerica", "southamerica", "us"},
+	"asia":       {"asia"},
+	"europe":     {"europe"},
+	"middleeast": {"me"},
+	"oceania":    {"australia"},
+}
+
+// Filter returns the endpoints of em whose region matches any of the
+// include patterns and none of the exclude patterns. All regions are
+// included if include is empty. Include patterns starting with "!" are
+// exclude patterns.
+//
+// A pattern is either a region name, a glob as accepted by path.Match
+// (e.g. europe-*), a region prefix (e.g. europe) or a continent in
+// Continents (e.g. americas). It is an error for an include pattern to
+// match no region.
+func Filter(em map[string]Endpoint, include, exclude []string) (map[string]Endpoint, error) {
+	var incl []string
+	excl := append([]string(nil), exclude...)
+	for _, p := range include {
+		if strings.HasPrefix(p, "!") {
+			excl = append(excl, strings.TrimPrefix(p, "!"))
+		} else {
+			incl = append(incl, p)
+		}
+	}
+
+	selected := make(map[string]Endpoint)
+	for r, e := range em {
+		if len(incl) == 0 {
+			selected[r] = e
+		}
+	}
+	for _, p := range incl {
+		found := false
+		for r, e := range em {
+			ok, err := matchRegion(p, r)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				selected[r] = e
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("pattern %q matches no region", p)
+		}
+	}
+	for _, p := range excl {
+		for r := range selected {
+			ok, err := matchRegion(p, r)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				delete(selected, r)
+			}
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no regions selected")
+	}
+	return selected, nil
+}
+
+// matchRegion reports whether region matches pattern.
+func matchRegion(pattern, region string) (bool, error) {
+	ok, err := path.Match(pattern, region)
+	if err != nil || ok {
+		return ok, err
+	}
+	prefix := region
+	if i := strings.Index(region, "-"); i >= 0 {
+		prefix = region[:i]
+	}
+	if pattern == prefix {
+		return true, nil
+	}
+	for _, p := range Continents[pattern] {
+		if p == prefix {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SplitList splits a comma-separated list, ignoring empty elements and
+// surrounding spaces.
+func SplitList(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilter(t *testing.T) {
+	em := map[string]Endpoint{
+		"global":             {},
+		"europe-west1":       {},
+		"europe-west10":      {},
+		"europe-north1":      {},
+		"us-central1":        {},
+		"northamerica-south": {},
+		"asia-east1":         {},
+	}
+	testCases := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "all",
+			want: []string{"asia-east1", "europe-north1", "europe-west1", "europe-west10", "global", "northamerica-south", "us-central1"},
+		},
+		{
+			name:    "names",
+			include: []string{"global", "us-central1"},
+			want:    []string{"global", "us-central1"},
+		},
+		{
+			name:    "glob",
+			include: []string{"europe-west*"},
+			want:    []string{"europe-west1", "europe-west10"},
+		},
+		{
+			name:    "prefix",
+			include: []string{"europe"},
+			want:    []string{"europe-north1", "europe-west1", "europe-west10"},
+		},
+		{
+			name:    "continent",
+			include: []string{"americas"},
+			want:    []string{"northamerica-south", "us-central1"},
+		},
+		{
+			name:    "negated include",
+			include: []string{"europe-*", "!europe-west1?"},
+			want:    []string{"europe-north1", "europe-west1"},
+		},
+		{
+			name:    "exclude only",
+			exclude: []string{"global", "europe", "americas"},
+			want:    []string{"asia-east1"},
+		},
+		{
+			name:    "no match",
+			include: []string{"mars-*"},
+			wantErr: true,
+		},
+		{
+			name:    "bad pattern",
+			include: []string{"europe-["},
+			wantErr: true,
+		},
+		{
+			name:    "nothing left",
+			include: []string{"global"},
+			exclude: []string{"*"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Filter(em, tc.include, tc.exclude)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Filter(): got error %v, want %v", err, tc.wantErr)
+			}
+			var regions []string
+			for r := range got {
+				regions = append(regions, r)
+			}
+			sort.Strings(regions)
+			if diff := cmp.Diff(tc.want, regions); diff != "" {
+				t.Errorf("Filter() = (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	if diff := cmp.Diff([]string{"a", "b*", "!c"}, SplitList(" a,,b* , !c,")); diff != "" {
+		t.Errorf("SplitList() = (-want, +got):\n%s", diff)
+	}
+	if got := SplitList(""); got != nil {
+		t.Errorf("SplitList(\"\") = %v, want nil", got)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httphandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logEntry is a structured log entry in the format understood by Cloud
+// Logging. See https://cloud.google.com/logging/docs/structured-logging.
+type logEntry struct {
+	Severity    string      `json:"severity"`
+	Message     string      `json:"message"`
+	Time        time.Time   `json:"time"`
+	HTTPRequest httpRequest `json:"httpRequest"`
+}
+
+// httpRequest is the httpRequest field of a Cloud Logging entry. See
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#HttpRequest.
+type httpRequest struct {
+	RequestMethod string `json:"requestMethod"`
+	RequestURL    string `json:"requestUrl"`
+	RequestSize   string `json:"requestSize,omitempty"`
+	Status        int    `json:"status"`
+	ResponseSize  string `json:"responseSize"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	RemoteIP      string `json:"remoteIp,omitempty"`
+	Referer       string `json:"referer,omitempty"`
+	Latency       string `json:"latency"`
+	Protocol      string `json:"protocol"`
+}
+
+// AccessLog returns a handler that serves requests with h and writes an
+// access log entry for each of them to out, as a line of JSON in the Cloud
+// Logging structured format.
+func AccessLog(h http.Handler, out io.Writer) http.Handler {
+	var mu sync.Mutex
+	enc := json.NewEncoder(out)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lw, r)
+
+		e := logEntry{
+			Severity: "INFO",
+			Message:  fmt.Sprintf("%s %s %d", r.Method, r.URL.RequestURI(), lw.status),
+			Time:     start,
+			HTTPRequest: httpRequest{
+				RequestMethod: r.Method,
+				RequestURL:    r.URL.RequestURI(),
+				Status:        lw.status,
+				ResponseSize:  strconv.FormatInt(lw.bytes, 10),
+				UserAgent:     r.UserAgent(),
+				RemoteIP:      remoteIP(r),
+				Referer:       r.Referer(),
+				Latency:       fmt.Sprintf("%.9fs", time.Since(start).Seconds()),
+				Protocol:      r.Proto,
+			},
+		}
+		if r.ContentLength > 0 {
+			e.HTTPRequest.RequestSize = strconv.FormatInt(r.ContentLength, 10)
+		}
+		if lw.status >= 500 {
+			e.Severity = "ERROR"
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(e)
+	})
+}
+
+// remoteIP returns the IP address of the client, as forwarded by a load
+// balancer or proxy if any. The proxy in front of Cloud Run appends the
+// address it received the request from to X-Forwarded-For, so only the
+// last entry of the last header line is trusted; earlier ones can be set
+// by the client.
+func remoteIP(r *http.Request) string {
+	if v := r.Header.Values("X-Forwarded-For"); len(v) > 0 {
+		f := v[len(v)-1]
+		if i := strings.LastIndex(f, ","); i >= 0 {
+			f = f[i+1:]
+		}
+		if ip := strings.TrimSpace(f); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loggingWriter records the status code and size of a response.
+type loggingWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *loggingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *loggingWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client, e.g. for gRPC.
+func (w *loggingWriter) Flush() {
+	w.wroteHeader = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack hijacks the connection, e.g. to upgrade it to a WebSocket.
+func (w *loggingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	return c, rw, err
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *loggingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
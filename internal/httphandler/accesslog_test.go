@@ -0,0 +1,138 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httphandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		handler http.HandlerFunc
+		want    logEntry
+	}{
+		{
+			name:   "ping",
+			method: http.MethodGet,
+			target: "/api/ping",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("test-region\n"))
+			},
+			want: logEntry{
+				Severity: "INFO",
+				Message:  "GET /api/ping 200",
+				HTTPRequest: httpRequest{
+					RequestMethod: "GET",
+					RequestURL:    "/api/ping",
+					Status:        200,
+					ResponseSize:  "12",
+					UserAgent:     "GCPing-CLI",
+					RemoteIP:      "203.0.113.1",
+					Protocol:      "HTTP/1.1",
+				},
+			},
+		},
+		{
+			name:   "upload",
+			method: http.MethodPost,
+			target: "/api/upload?x=1",
+			body:   "abcd",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "failed", http.StatusServiceUnavailable)
+			},
+			want: logEntry{
+				Severity: "ERROR",
+				Message:  "POST /api/upload?x=1 503",
+				HTTPRequest: httpRequest{
+					RequestMethod: "POST",
+					RequestURL:    "/api/upload?x=1",
+					RequestSize:   "4",
+					Status:        503,
+					ResponseSize:  "7",
+					UserAgent:     "GCPing-CLI",
+					RemoteIP:      "203.0.113.1",
+					Protocol:      "HTTP/1.1",
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			h := AccessLog(tc.handler, &out)
+			req := httptest.NewRequest(tc.method, "https://gcping.com"+tc.target, strings.NewReader(tc.body))
+			req.Header.Set("User-Agent", "GCPing-CLI")
+			req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.1")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			var got logEntry
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to decode log entry %q: %v", out.String(), err)
+			}
+			if got.Time.IsZero() || got.HTTPRequest.Latency == "" {
+				t.Errorf("AccessLog() entry is missing time or latency: %q", out.String())
+			}
+			opts := cmpopts.IgnoreFields(logEntry{}, "Time", "HTTPRequest.Latency")
+			if diff := cmp.Diff(tc.want, got, opts); diff != "" {
+				t.Errorf("AccessLog() entry (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		forwardedFor []string // header lines
+		want         string
+	}{
+		{nil, "192.0.2.1"},
+		{[]string{"203.0.113.1"}, "203.0.113.1"},
+		// The client can set the first entries.
+		{[]string{"198.51.100.1, 203.0.113.1"}, "203.0.113.1"},
+		{[]string{"198.51.100.1,203.0.113.1"}, "203.0.113.1"},
+		// or its own header line, before the one of the proxy.
+		{[]string{"198.51.100.1", "203.0.113.1"}, "203.0.113.1"},
+		{[]string{"198.51.100.1", "198.51.100.2, 203.0.113.1"}, "203.0.113.1"},
+		{[]string{" , "}, "192.0.2.1"},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, f := range tc.forwardedFor {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+		if got := remoteIP(req); got != tc.want {
+			t.Errorf("remoteIP() with X-Forwarded-For %q = %q, want %q", tc.forwardedFor, got, tc.want)
+		}
+	}
+}
@@ -15,14 +15,24 @@
 package httphandler
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcping/internal/config"
 )
 
+// MaxPayloadBytes is the largest body served by HandleDownload and accepted
+// by HandleUpload.
+const MaxPayloadBytes = 100 << 20
+
 // Options contains parameters for Handler.
 type Options struct {
 	// StaticRoot is the root for static serving content.
@@ -31,6 +41,16 @@ type Options struct {
 	Region string
 	// Endpoints is a list of available endpoints.
 	Endpoints map[string]config.Endpoint
+	// Metrics mounts /metrics with Prometheus metrics about the requests
+	// served by the Handler.
+	Metrics bool
+	// GRPC serves the gRPC health service to gRPC requests. The server
+	// must accept HTTP/2, e.g. unencrypted with http.Protocols.
+	GRPC bool
+	// Throughput mounts /api/download and /api/upload for throughput
+	// tests. They are off by default, as they serve up to MaxPayloadBytes
+	// of egress to anyone.
+	Throughput bool
 }
 
 // Handler is a http.Handler implementation
@@ -38,6 +58,15 @@ type Handler struct {
 	Options
 	once    sync.Once
 	handler http.Handler
+	metrics *metrics     // nil unless Metrics is set
+	grpc    http.Handler // nil unless GRPC is set
+
+	// endpoints is the JSON encoding of Endpoints, served with
+	// endpointsETag and endpointsModTime for conditional requests.
+	endpoints        []byte
+	endpointsErr     error
+	endpointsETag    string
+	endpointsModTime time.Time
 }
 
 // New returns a new intance of Handler based on opt.
@@ -46,22 +75,57 @@ func New(opts *Options) *Handler {
 		Options: *opts,
 	}
 
+	// Endpoints don't change for the lifetime of the Handler, so encode
+	// them once.
+	var b bytes.Buffer
+	s.endpointsErr = json.NewEncoder(&b).Encode(s.Endpoints)
+	s.endpoints = b.Bytes()
+	s.endpointsETag = fmt.Sprintf(`"%x"`, sha256.Sum256(s.endpoints))
+	s.endpointsModTime = time.Now()
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.StaticHandler())
+	handle := func(route string, h http.HandlerFunc) {
+		if s.metrics != nil {
+			mux.Handle(route, s.metrics.instrument(route, h))
+			return
+		}
+		mux.Handle(route, h)
+	}
+	if s.Metrics {
+		s.metrics = newMetrics(s.Region)
+		mux.Handle("/metrics", s.metrics.handler())
+	}
+	if s.GRPC {
+		s.grpc = s.newGRPCServer()
+		if s.metrics != nil {
+			s.grpc = s.metrics.instrument("grpc", s.grpc)
+		}
+	}
+	handle("/", s.StaticHandler())
 
 	// TODO: clean up after PR#138 is merged and tested https://github.com/GoogleCloudPlatform/gcping/pull/138
-	mux.HandleFunc("/api/endpoints", s.HandleEndpoints)
+	handle("/api/endpoints", s.HandleEndpoints)
 
-	mux.HandleFunc("/api/ping", s.HandlePing)
+	handle("/api/ping", s.HandlePing)
+	handle("/api/time", s.HandleTime)
+	handle("/api/ws", s.HandleWebSocket)
+	if s.Throughput {
+		handle("/api/download", s.HandleDownload)
+		handle("/api/upload", s.HandleUpload)
+	}
 
 	// Serve /ping with region response to fix issue#96 on older cli versions.
-	mux.HandleFunc("/ping", s.HandlePing)
+	handle("/ping", s.HandlePing)
 	s.handler = mux
 	return s
 }
 
 // ServeHTTP implements http.Handler.
 func (s *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.grpc != nil && isGRPC(r) {
+		s.grpc.ServeHTTP(w, r)
+		return
+	}
 	s.handler.ServeHTTP(w, r)
 }
 
@@ -75,28 +139,131 @@ func (s *Handler) StaticHandler() http.HandlerFunc {
 	}
 }
 
-// HandleEndpoints returns a list of available endpoints as JSON.
+// HandleEndpoints returns a list of available endpoints as JSON. It sets
+// ETag and Last-Modified and answers conditional requests with 304 Not
+// Modified.
 func (s *Handler) HandleEndpoints(w http.ResponseWriter, r *http.Request) {
 	addHeaders(w)
-	w.Header().Add("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(s.Endpoints); err != nil {
+	if s.endpointsErr != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	w.Header().Add("Content-Type", "application/json")
+	// Let caches keep the list, but revalidate it with the validators.
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", s.endpointsETag)
+	http.ServeContent(w, r, "", s.endpointsModTime, bytes.NewReader(s.endpoints))
 }
 
 // HandlePing returns the current region as a response for ping.
 func (s *Handler) HandlePing(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	addHeaders(w)
-	s.once.Do(func() {
+	if s.firstRequest() {
 		w.Header().Add("X-First-Request", "true")
-	})
+	}
+	addServerTiming(w, start)
 	fmt.Fprintln(w, s.Region)
 }
 
+// TimeResponse is the response of HandleTime. Timestamps are in Unix
+// nanoseconds.
+type TimeResponse struct {
+	// Receive is the time the request was received.
+	Receive int64 `json:"receive"`
+	// Transmit is the time the response was sent.
+	Transmit int64 `json:"transmit"`
+}
+
+// HandleTime responds with the times the request was received and the
+// response sent, for NTP-style estimation of the clock offset and one-way
+// delays between client and server.
+func (s *Handler) HandleTime(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	addHeaders(w)
+	w.Header().Set("Content-Type", "application/json")
+	addServerTiming(w, start)
+	b, _ := json.Marshal(TimeResponse{
+		Receive:  start.UnixNano(),
+		Transmit: time.Now().UnixNano(),
+	})
+	w.Write(append(b, '\n'))
+}
+
+// firstRequest reports whether this is the first ping served by the
+// instance.
+func (s *Handler) firstRequest() bool {
+	first := false
+	s.once.Do(func() {
+		first = true
+		if s.metrics != nil {
+			s.metrics.firstRequests.Inc()
+		}
+	})
+	return first
+}
+
+// HandleDownload responds with the number of bytes requested in the bytes
+// query parameter, for throughput tests.
+func (s *Handler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	addHeaders(w)
+	n, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+	if err != nil || n < 0 || n > MaxPayloadBytes {
+		http.Error(w, fmt.Sprintf("bytes must be between 0 and %d", MaxPayloadBytes), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+	io.CopyN(w, zeros{}, n)
+}
+
+// HandleUpload reads the request body and responds with the number of bytes
+// received, for throughput tests.
+func (s *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	addHeaders(w)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, MaxPayloadBytes))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintln(w, n)
+}
+
+// zeros is an io.Reader of an infinite stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
 func addHTSTHeader(w http.ResponseWriter) {
 	w.Header().Add("Strict-Transport-Security", "max-age=3600; includeSubdomains; preload")
 }
 
+// addServerTiming sets the Server-Timing header to the time spent handling
+// a request received at start, so that clients can tell server time from
+// network time. The "app" metric is the duration in milliseconds and the
+// "recv" metric holds the receive time in Unix nanoseconds.
+func addServerTiming(w http.ResponseWriter, start time.Time) {
+	dur := strconv.FormatFloat(float64(time.Since(start))/float64(time.Millisecond), 'f', -1, 64)
+	w.Header().Set("Server-Timing", fmt.Sprintf(`app;dur=%s, recv;desc="%d"`, dur, start.UnixNano()))
+	// Let browsers read Server-Timing from other origins.
+	w.Header().Set("Timing-Allow-Origin", "*")
+}
+
 func addHeaders(w http.ResponseWriter) {
 	addHTSTHeader(w)
 	w.Header().Add("Cache-Control", "no-store")
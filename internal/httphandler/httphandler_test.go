@@ -15,15 +15,24 @@
 package httphandler
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/GoogleCloudPlatform/gcping/internal/config"
+	"github.com/coder/websocket"
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 )
 
 func TestEndpoints(t *testing.T) {
@@ -37,14 +46,22 @@ func TestEndpoints(t *testing.T) {
 	t.Cleanup(func() { resp.Body.Close() })
 	wantHeader := http.Header{
 		"Content-Type":                {"application/json"},
-		"Cache-Control":               {"no-store"},
+		"Cache-Control":               {"no-cache"},
 		"Access-Control-Allow-Origin": {"*"},
 		"Strict-Transport-Security":   {"max-age=3600; includeSubdomains; preload"},
+		"Accept-Ranges":               {"bytes"},
 	}
 
 	if got, want := resp.StatusCode, http.StatusOK; got != want {
 		t.Errorf("HandleEndpoints() Status Code: got %v, want %v", got, want)
 	}
+	// Validators and length vary with the content and start time.
+	for _, h := range []string{"Etag", "Last-Modified", "Content-Length"} {
+		if resp.Header.Get(h) == "" {
+			t.Errorf("HandleEndpoints() Header %s is missing", h)
+		}
+		resp.Header.Del(h)
+	}
 	if diff := cmp.Diff(wantHeader, resp.Header); diff != "" {
 		t.Errorf("HandleEndpoiints() Header (-want, +got):\n%s", diff)
 	}
@@ -59,6 +76,46 @@ func TestEndpoints(t *testing.T) {
 	}
 }
 
+func TestEndpointsConditional(t *testing.T) {
+	t.Parallel()
+
+	handler := New(&Options{Endpoints: config.AllEndpoints})
+	get := func(header http.Header) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "https://gcping.com/api/endpoints", nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		handler.HandleEndpoints(w, req)
+		resp := w.Result()
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	first := get(nil)
+	etag, lastModified := first.Header.Get("ETag"), first.Header.Get("Last-Modified")
+
+	testCases := []struct {
+		name     string
+		header   http.Header
+		wantCode int
+	}{
+		{"matching etag", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"stale etag", http.Header{"If-None-Match": {`"stale"`}}, http.StatusOK},
+		{"not modified since", http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified},
+		{"modified since", http.Header{"If-Modified-Since": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(tc.header)
+			if got := resp.StatusCode; got != tc.wantCode {
+				t.Errorf("HandleEndpoints() Status Code: got %v, want %v", got, tc.wantCode)
+			}
+		})
+	}
+}
+
+var serverTimingRE = regexp.MustCompile(`^app;dur=\d+(\.\d+)?, recv;desc="\d+"$`)
+
 func TestPing(t *testing.T) {
 	t.Parallel()
 
@@ -74,6 +131,7 @@ func TestPing(t *testing.T) {
 				"Access-Control-Allow-Origin": {"*"},
 				"X-First-Request":             {"true"},
 				"Strict-Transport-Security":   {"max-age=3600; includeSubdomains; preload"},
+				"Timing-Allow-Origin":         {"*"},
 			},
 		},
 		{
@@ -83,6 +141,7 @@ func TestPing(t *testing.T) {
 				"Cache-Control":               {"no-store"},
 				"Access-Control-Allow-Origin": {"*"},
 				"Strict-Transport-Security":   {"max-age=3600; includeSubdomains; preload"},
+				"Timing-Allow-Origin":         {"*"},
 			},
 		},
 	}
@@ -100,6 +159,11 @@ func TestPing(t *testing.T) {
 			if got, want := resp.StatusCode, http.StatusOK; got != want {
 				t.Errorf("HandlePing() Status Code: got %v, want %v", got, want)
 			}
+			// Server-Timing varies with the time of the request.
+			if st := resp.Header.Get("Server-Timing"); !serverTimingRE.MatchString(st) {
+				t.Errorf("HandlePing() Server-Timing = %q, want match for %v", st, serverTimingRE)
+			}
+			resp.Header.Del("Server-Timing")
 			if diff := cmp.Diff(tc.wantHeader, resp.Header); diff != "" {
 				t.Errorf("HandlePing() Header (-want, +got):\n%s", diff)
 			}
@@ -114,6 +178,119 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestTime(t *testing.T) {
+	t.Parallel()
+
+	handler := New(&Options{Region: "test-region"})
+	req := httptest.NewRequest(http.MethodGet, "https://gcping.com/api/time", nil)
+	w := httptest.NewRecorder()
+	before := time.Now().UnixNano()
+	handler.HandleTime(w, req)
+	after := time.Now().UnixNano()
+	resp := w.Result()
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Errorf("HandleTime() Status Code: got %v, want %v", got, want)
+	}
+	if got, want := resp.Header.Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("HandleTime() Content-Type: got %q, want %q", got, want)
+	}
+	var got TimeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode JSON: %v", err)
+	}
+	if got.Receive < before || got.Receive > got.Transmit || got.Transmit > after {
+		t.Errorf("HandleTime() = %+v, want %d <= receive <= transmit <= %d", got, before, after)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		query    string
+		wantCode int
+		wantLen  int
+	}{
+		{"bytes=0", http.StatusOK, 0},
+		{"bytes=100000", http.StatusOK, 100000},
+		{"", http.StatusBadRequest, -1},
+		{"bytes=-1", http.StatusBadRequest, -1},
+		{"bytes=invalid", http.StatusBadRequest, -1},
+		{"bytes=104857601", http.StatusBadRequest, -1},
+	}
+
+	handler := New(&Options{Region: "test-region"})
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.query, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "https://gcping.com/api/download?"+tc.query, nil)
+			w := httptest.NewRecorder()
+			handler.HandleDownload(w, req)
+			resp := w.Result()
+			t.Cleanup(func() { resp.Body.Close() })
+
+			if got := resp.StatusCode; got != tc.wantCode {
+				t.Errorf("HandleDownload() Status Code: got %v, want %v", got, tc.wantCode)
+			}
+			if tc.wantLen < 0 {
+				return
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("Failed to read response body: %v", err)
+			}
+			if len(got) != tc.wantLen {
+				t.Errorf("HandleDownload() body length = got %d, want %d", len(got), tc.wantLen)
+			}
+		})
+	}
+}
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		method   string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"empty", http.MethodPost, "", http.StatusOK, "0\n"},
+		{"body", http.MethodPost, strings.Repeat("a", 1000), http.StatusOK, "1000\n"},
+		{"get", http.MethodGet, "", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+	}
+
+	handler := New(&Options{Region: "test-region"})
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tc.method, "https://gcping.com/api/upload", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			handler.HandleUpload(w, req)
+			resp := w.Result()
+			t.Cleanup(func() { resp.Body.Close() })
+
+			if got := resp.StatusCode; got != tc.wantCode {
+				t.Errorf("HandleUpload() Status Code: got %v, want %v", got, tc.wantCode)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Errorf("Failed to read response body: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantBody, string(got)); diff != "" {
+				t.Errorf("HandleUpload() = (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestRouting(t *testing.T) {
 	t.Parallel()
 
@@ -125,6 +302,7 @@ func TestRouting(t *testing.T) {
 	handler := New(&Options{
 		StaticRoot: http.FS(fakeStatic),
 		Region:     "test-region",
+		Throughput: true,
 		Endpoints: map[string]config.Endpoint{
 			"test-region": {
 				URL:        "https://test-region",
@@ -148,6 +326,8 @@ func TestRouting(t *testing.T) {
 		{"/api/ping", http.StatusOK, "test-region\n"},
 		{"/api/endpoints", http.StatusOK, `{"test-region":{"URL":"https://test-region","Region":"test-region","RegionName":"Test Region"}}` + "\n"},
 		{"/ping", http.StatusOK, "test-region\n"},
+		{"/api/download?bytes=4", http.StatusOK, "\x00\x00\x00\x00"},
+		{"/api/upload", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
 	}
 	for _, tc := range testCases {
 		tc := tc
@@ -172,3 +352,162 @@ func TestRouting(t *testing.T) {
 		})
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	handler := New(&Options{Region: "test-region", Metrics: true, Throughput: true})
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	client := ts.Client()
+
+	get := func(path string) string {
+		resp, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Get() failed: %v", err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("ReadAll() failed for response body: %v", err)
+		}
+		return string(b)
+	}
+	get("/api/ping")
+	get("/api/ping")
+	get("/api/download?bytes=invalid")
+
+	got := get("/metrics")
+	for _, want := range []string{
+		`gcping_server_requests_total{code="200",route="/api/ping"} 2`,
+		`gcping_server_requests_total{code="400",route="/api/download"} 1`,
+		`gcping_server_request_duration_seconds_count{code="200",route="/api/ping"} 2`,
+		`gcping_server_first_requests_total 1`,
+		`gcping_server_info{region="test-region"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("/metrics is missing %q", want)
+		}
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	t.Parallel()
+
+	handler := New(&Options{Region: "test-region", StaticRoot: http.FS(fstest.MapFS{})})
+	req := httptest.NewRequest(http.MethodGet, "https://gcping.com/metrics", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusNotFound; got != want {
+		t.Errorf("ServeHTTP() Status Code: got %v, want %v", got, want)
+	}
+}
+
+func TestThroughputDisabled(t *testing.T) {
+	t.Parallel()
+
+	handler := New(&Options{Region: "test-region", StaticRoot: http.FS(fstest.MapFS{})})
+	for _, path := range []string{"/api/download?bytes=4", "/api/upload"} {
+		req := httptest.NewRequest(http.MethodPost, "https://gcping.com"+path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got, want := w.Code, http.StatusNotFound; got != want {
+			t.Errorf("ServeHTTP(%s) Status Code: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	t.Parallel()
+
+	handler := New(&Options{Region: "test-region"})
+	body := io.LimitReader(zeros{}, MaxPayloadBytes+1)
+	req := httptest.NewRequest(http.MethodPost, "https://gcping.com/api/upload", body)
+	w := httptest.NewRecorder()
+	handler.HandleUpload(w, req)
+	if got, want := w.Code, http.StatusRequestEntityTooLarge; got != want {
+		t.Errorf("HandleUpload() Status Code: got %v, want %v", got, want)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	t.Parallel()
+
+	// Access logs must not get in the way of the upgrade.
+	var log strings.Builder
+	ts := httptest.NewServer(AccessLog(New(&Options{Region: "test-region", Metrics: true}), &log))
+	t.Cleanup(ts.Close)
+
+	ctx := context.Background()
+	c, _, err := websocket.Dial(ctx, ts.URL+"/api/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial() failed: %v", err)
+	}
+	t.Cleanup(func() { c.CloseNow() })
+	for _, msg := range []string{"a", "bc"} {
+		if err := c.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+		typ, got, err := c.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read() failed: %v", err)
+		}
+		if typ != websocket.MessageText || string(got) != msg {
+			t.Errorf("Read() = %v %q, want %v %q", typ, got, websocket.MessageText, msg)
+		}
+	}
+
+	// Requests that aren't upgrades fail.
+	resp, err := ts.Client().Get(ts.URL + "/api/ws")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusUpgradeRequired; got != want {
+		t.Errorf("Get() Status Code = got %d, want %d", got, want)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	t.Parallel()
+
+	var log strings.Builder
+	ts := httptest.NewUnstartedServer(AccessLog(New(&Options{Region: "test-region", Metrics: true, GRPC: true}), &log))
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	cc, err := grpc.NewClient(ts.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	for _, wantFirst := range []bool{true, false} {
+		var md metadata.MD
+		res, err := healthpb.NewHealthClient(cc).Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Header(&md))
+		if err != nil {
+			t.Fatalf("Check() failed: %v", err)
+		}
+		if got, want := res.GetStatus(), healthpb.HealthCheckResponse_SERVING; got != want {
+			t.Errorf("Check() = %v, want %v", got, want)
+		}
+		if got, want := md.Get("x-region"), []string{"test-region"}; !cmp.Equal(got, want) {
+			t.Errorf("Check() x-region = %q, want %q", got, want)
+		}
+		if got := len(md.Get("x-first-request")) > 0; got != wantFirst {
+			t.Errorf("Check() x-first-request set = %v, want %v", got, wantFirst)
+		}
+	}
+
+	// Other requests are still served over HTTP/1.1.
+	resp, err := ts.Client().Get(ts.URL + "/api/ping")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Errorf("Get() Status Code = got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httphandler
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics are the Prometheus metrics served on /metrics.
+type metrics struct {
+	registry      *prometheus.Registry
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	firstRequests prometheus.Counter
+}
+
+func newMetrics(region string) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gcping_server_requests_total",
+			Help: "Number of requests served by route and status code.",
+		}, []string{"route", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gcping_server_request_duration_seconds",
+			Help:    "Time to serve requests by route and status code.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"route", "code"}),
+		firstRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gcping_server_first_requests_total",
+			Help: "Number of responses with X-First-Request set.",
+		}),
+	}
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "gcping_server_info",
+		Help:        "Always 1, labelled by the region of the instance.",
+		ConstLabels: prometheus.Labels{"region": region},
+	})
+	info.Set(1)
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.firstRequests,
+		info,
+		// Exports process_start_time_seconds among others.
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+	)
+	return m
+}
+
+// instrument returns h counting and timing its requests under route.
+func (m *metrics) instrument(route string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+	h = promhttp.InstrumentHandlerDuration(m.duration.MustCurryWith(labels), h)
+	return promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), h)
+}
+
+// handler returns the handler of /metrics.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httphandler
+
+import (
+	"net/http"
+
+	"github.com/coder/websocket"
+)
+
+// HandleWebSocket upgrades the request to a WebSocket connection and
+// echoes every message it receives, for round trip measurements over a
+// persistent connection.
+func (s *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	addHeaders(w)
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		// Like the other routes, accept requests from any origin.
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		// Accept has written an error response.
+		return
+	}
+	defer c.CloseNow()
+
+	ctx := r.Context()
+	for {
+		typ, msg, err := c.Read(ctx)
+		if err != nil {
+			return
+		}
+		if err := c.Write(ctx, typ, msg); err != nil {
+			return
+		}
+	}
+}
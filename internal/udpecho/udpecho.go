@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package udpecho implements the UDP echo service used to measure round
+// trips and packet loss. A packet is Magic followed by a big-endian 64-bit
+// sequence number, and the server sends it back unchanged.
+package udpecho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+)
+
+const (
+	// DefaultPort is the port the echo server listens on by default.
+	DefaultPort = 8081
+	// Magic starts every packet. Other packets are dropped so that the
+	// server can't be used to reflect arbitrary traffic.
+	Magic = "gcping"
+	// PacketSize is the size of a packet.
+	PacketSize = len(Magic) + 8
+)
+
+// Packet returns the packet with sequence number seq.
+func Packet(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(Magic), seq)
+}
+
+// Seq returns the sequence number of packet b, and false if b is not a
+// valid packet.
+func Seq(b []byte) (uint64, bool) {
+	if len(b) != PacketSize || !bytes.HasPrefix(b, []byte(Magic)) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(b[len(Magic):]), true
+}
+
+// Serve echoes the valid packets received on pc until reading from pc
+// fails, e.g. because it was closed, and returns that error.
+func Serve(pc net.PacketConn) error {
+	// Read one more byte than needed to detect oversized packets.
+	buf := make([]byte, PacketSize+1)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if _, ok := Seq(buf[:n]); !ok {
+			continue
+		}
+		pc.WriteTo(buf[:n], addr)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package udpecho
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSeq(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		packet  []byte
+		wantSeq uint64
+		wantOK  bool
+	}{
+		{"valid", Packet(42), 42, true},
+		{"zero", Packet(0), 0, true},
+		{"short", Packet(42)[:PacketSize-1], 0, false},
+		{"long", append(Packet(42), 0), 0, false},
+		{"no magic", append([]byte("GCPING"), Packet(42)[len(Magic):]...), 0, false},
+	}
+	for _, tc := range testCases {
+		seq, ok := Seq(tc.packet)
+		if seq != tc.wantSeq || ok != tc.wantOK {
+			t.Errorf("%s: Seq(%q) = %d, %v, want %d, %v", tc.name, tc.packet, seq, ok, tc.wantSeq, tc.wantOK)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- Serve(pc) }()
+
+	c, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Invalid packets are dropped, so the first reply is to the valid one.
+	c.Write([]byte("hello"))
+	c.Write(append(Packet(1), 'x'))
+	c.Write(Packet(2))
+	buf := make([]byte, 64)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if got, want := buf[:n], Packet(2); !bytes.Equal(got, want) {
+		t.Errorf("Read() = %q, want %q", got, want)
+	}
+
+	pc.Close()
+	if err := <-done; err == nil {
+		t.Error("Serve() = nil after close, want error")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+// jsonReport is the document printed by -format json.
+type jsonReport struct {
+	Regions []jsonRegion `json:"regions"`
+}
+
+// jsonRegion holds the aggregated results of a region.
+type jsonRegion struct {
+	Rank       int         `json:"rank"`
+	Region     string      `json:"region"`
+	RegionName string      `json:"region_name"`
+	URL        string      `json:"url"`
+	Stats      jsonStats   `json:"stats"`
+	Phases     *jsonPhases `json:"phases,omitempty"`
+	Samples    []int64     `json:"samples_ns"`
+	Protocol   string      `json:"protocol,omitempty"`
+	Addrs      []string    `json:"addrs,omitempty"`
+	Errors     int         `json:"errors"`
+	ColdStarts int         `json:"cold_starts"`
+	Throughput float64     `json:"throughput_mbps,omitempty"`
+	OneWay     *jsonOneWay `json:"one_way,omitempty"`
+	UDP        *jsonUDP    `json:"udp,omitempty"`
+}
+
+type jsonStats struct {
+	Min    int64 `json:"min_ns"`
+	Max    int64 `json:"max_ns"`
+	Mean   int64 `json:"mean_ns"`
+	StdDev int64 `json:"stddev_ns"`
+	P50    int64 `json:"p50_ns"`
+	P90    int64 `json:"p90_ns"`
+	P95    int64 `json:"p95_ns"`
+	P99    int64 `json:"p99_ns"`
+	Jitter int64 `json:"jitter_ns"`
+}
+
+type jsonPhases struct {
+	DNS     int64 `json:"dns_ns"`
+	Connect int64 `json:"connect_ns"`
+	TLS     int64 `json:"tls_ns"`
+	TTFB    int64 `json:"ttfb_ns"`
+	Server  int64 `json:"server_ns"`
+	Network int64 `json:"network_ns"`
+}
+
+// jsonOneWay holds the one-way delay estimates of -one-way.
+type jsonOneWay struct {
+	Offset     int64 `json:"offset_ns"`
+	Upstream   int64 `json:"upstream_ns"`
+	Downstream int64 `json:"downstream_ns"`
+}
+
+// jsonUDP holds the packet loss and reordering of -proto udp.
+type jsonUDP struct {
+	Loss      float64 `json:"loss_pct"`
+	Reordered int     `json:"reordered"`
+}
+
+// jsonSample is a single ping, printed as a line by -format ndjson.
+type jsonSample struct {
+	Region     string      `json:"region"`
+	RegionName string      `json:"region_name"`
+	URL        string      `json:"url"`
+	Latency    int64       `json:"latency_ns"`
+	Bytes      int64       `json:"bytes,omitempty"`
+	Protocol   string      `json:"protocol,omitempty"`
+	Addr       string      `json:"addr,omitempty"`
+	ColdStart  bool        `json:"cold_start"`
+	Reordered  bool        `json:"reordered,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Phases     *jsonPhases `json:"phases,omitempty"`
+}
+
+func newJSONStats(s probe.Stats) jsonStats {
+	return jsonStats{
+		Min:    s.Min.Nanoseconds(),
+		Max:    s.Max.Nanoseconds(),
+		Mean:   s.Mean.Nanoseconds(),
+		StdDev: s.StdDev.Nanoseconds(),
+		P50:    s.P50.Nanoseconds(),
+		P90:    s.P90.Nanoseconds(),
+		P95:    s.P95.Nanoseconds(),
+		P99:    s.P99.Nanoseconds(),
+		Jitter: s.Jitter.Nanoseconds(),
+	}
+}
+
+// newJSONPhases returns nil unless -phases is set, so phases are omitted
+// from the output by default.
+func newJSONPhases(p probe.Phases) *jsonPhases {
+	if !showPhases {
+		return nil
+	}
+	return &jsonPhases{
+		DNS:     p.DNS.Nanoseconds(),
+		Connect: p.Connect.Nanoseconds(),
+		TLS:     p.TLS.Nanoseconds(),
+		TTFB:    p.TTFB.Nanoseconds(),
+		Server:  p.Server.Nanoseconds(),
+		Network: p.Network.Nanoseconds(),
+	}
+}
+
+func nanoseconds(d []time.Duration) []int64 {
+	ns := make([]int64, len(d))
+	for i, v := range d {
+		ns[i] = v.Nanoseconds()
+	}
+	return ns
+}
@@ -19,107 +19,605 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/GoogleCloudPlatform/gcping/internal/config"
+	"github.com/GoogleCloudPlatform/gcping/internal/udpecho"
+	"github.com/GoogleCloudPlatform/gcping/probe"
 )
 
 var (
-	top          bool
+	top          topFlag // number of top regions printed
+	topLatency   bool
 	number       int // number of requests for each region
 	concurrency  int
 	timeout      time.Duration
 	csv          bool
 	csvCum       bool
+	format       string
 	verbose      bool
-	region       string
+	showPhases   bool
+	statCols     []string // stats reported per region
+	region       string   // comma-separated list of regions
+	include      string
+	exclude      string
+	mode         string
+	proto        string
+	coldStarts   bool // include cold starts in stats
+	watchMode    bool
+	interval     time.Duration
+	metricsAddr  string // address of the Prometheus exporter
 	endpointsURL string
-	// TODO(jbd): Add payload options such as body size.
-
-	client *http.Client // TODO(jbd): One client per worker?
+	endpointFile string
+	cacheTTL     time.Duration
+	download     int64 // payload size of throughput tests, in bytes
+	upload       int64
+	oneWay       bool // estimate one-way delays
+	udpPort      int
+	httpVersion  string // HTTP version chosen with -http
+	family       string // address family: "4", "6" or "both"
 )
 
 func main() {
-	flag.BoolVar(&top, "top", false, "")
+	flag.Var(&top, "top", "")
+	flag.BoolVar(&topLatency, "latency", false, "")
 	flag.IntVar(&number, "n", 10, "")
 	flag.IntVar(&concurrency, "c", 10, "")
 	flag.DurationVar(&timeout, "t", time.Duration(0), "")
 	flag.BoolVar(&verbose, "v", false, "")
+	flag.BoolVar(&showPhases, "phases", false, "")
+	statsFlag := flag.String("stats", "median", "")
 	flag.BoolVar(&csv, "csv", false, "")
 	flag.BoolVar(&csvCum, "csv-cum", false, "")
+	flag.StringVar(&format, "format", "text", "")
 	flag.StringVar(&region, "r", "", "")
-	flag.StringVar(&endpointsURL, "url", "https://global.gcping.com/api/endpoints", "")
+	flag.StringVar(&include, "include", "", "")
+	flag.StringVar(&exclude, "exclude", "", "")
+	flag.StringVar(&mode, "mode", "", "")
+	flag.StringVar(&proto, "proto", "http", "")
+	flag.IntVar(&udpPort, "udp-port", udpecho.DefaultPort, "")
+	flag.StringVar(&httpVersion, "http", "", "")
+	ipv4 := flag.Bool("4", false, "")
+	ipv6 := flag.Bool("6", false, "")
+	flag.StringVar(&family, "family", "", "")
+	flag.BoolVar(&coldStarts, "include-cold-starts", false, "")
+	flag.BoolVar(&watchMode, "watch", false, "")
+	flag.DurationVar(&interval, "interval", 5*time.Second, "")
+	flag.StringVar(&metricsAddr, "serve-metrics", "", "")
+	flag.Int64Var(&download, "download", 0, "")
+	flag.Int64Var(&upload, "upload", 0, "")
+	flag.BoolVar(&oneWay, "one-way", false, "")
+	flag.StringVar(&endpointsURL, "url", probe.DefaultEndpointsURL, "")
+	flag.StringVar(&endpointFile, "endpoints-file", "", "")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 24*time.Hour, "")
 
-	flag.Usage = usage
-	flag.Parse()
+	flag.Var(maxMedian, "max-median", "")
+	flag.Var(maxP95, "max-p95", "")
+	flag.Var(maxErrorRate, "max-error-rate", "")
+	flag.Var(warning, "warning", "")
+	flag.Var(critical, "critical", "")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	flag.Usage = usage
+	parseFlags(os.Args[1:])
+	args, err := top.count(flag.Args())
+	if err != nil {
+		configError(err.Error())
+	}
+	if len(args) < flag.NArg() {
+		parseFlags(args)
+	}
+	if flag.NArg() > 0 {
+		configError(fmt.Sprintf("unexpected argument %q", flag.Arg(0)))
+	}
 
-	// Fetch and cache endpoint map in memory for the duration of the
-	// process.
-	endpoints, err := config.EndpointsFromServer(ctx, endpointsURL)
+	endpoints, err := loadEndpoints()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		configError(err.Error())
 	}
 
-	if number < 0 || concurrency <= 0 {
-		usage()
+	if number <= 0 || concurrency <= 0 || interval <= 0 || download < 0 || upload < 0 {
+		if format != "nagios" {
+			usage()
+			os.Exit(exitConfig)
+		}
+		configError("-n, -c and -interval must be positive and -download and -upload can't be negative")
+	}
+	if download > 0 && upload > 0 {
+		configError("-download and -upload can't be used together")
+	}
+	if oneWay && (transfer() || watchMode || metricsAddr != "" || mode == "both") {
+		configError("-one-way can't be used with -download, -upload, -watch, -serve-metrics or -mode both")
+	}
+	statCols, err = parseStatColumns(*statsFlag)
+	if err != nil {
+		configError(err.Error())
+	}
+	switch format {
+	case "text":
+	case "json", "ndjson", "nagios":
+		// Keep stdout parseable.
+		verbose = false
+		csv = false
+	default:
+		configError(fmt.Sprintf("format %q is not supported", format))
+	}
+	if format == "nagios" && thresholdsSet() {
+		configError("-max-median, -max-p95 and -max-error-rate can't be used with -format nagios; use -warning and -critical")
+	}
+	if thresholdsSet() && (watchMode || metricsAddr != "") {
+		configError("-max-median, -max-p95 and -max-error-rate can't be used with -watch or -serve-metrics")
 	}
 	if csv {
 		verbose = false // if output is CSV, no need for verbose output
 	}
 
-	if region != "" {
-		if _, found := endpoints[region]; !found {
-			fmt.Printf("region %q is not supported or does not exist\n", region)
-			os.Exit(1)
+	opts := probe.Options{
+		Number:            number,
+		Concurrency:       concurrency,
+		Timeout:           timeout,
+		IncludeColdStarts: coldStarts,
+		Download:          download,
+		Upload:            upload,
+		Clock:             oneWay,
+	}
+	if verbose && !watchMode && metricsAddr == "" {
+		opts.BeforePing = printPing
+	}
+	switch mode {
+	case "":
+	case "cold":
+		opts.Mode = probe.Cold
+	case "warm":
+		opts.Mode = probe.Warm
+	case "both":
+		if top > 0 || watchMode || metricsAddr != "" || format == "ndjson" || format == "nagios" {
+			configError("-mode both can't be used with -top, -watch, -serve-metrics or -format ndjson or nagios")
+		}
+	default:
+		configError(fmt.Sprintf("mode %q is not supported", mode))
+	}
+	switch proto {
+	case "http":
+	case "ws", "tcp", "udp":
+		if mode != "" || transfer() || oneWay {
+			configError(fmt.Sprintf("-proto %s can't be used with -mode, -download, -upload or -one-way", proto))
+		}
+		switch proto {
+		case "ws":
+			opts.Proto = probe.WebSocket
+		case "tcp":
+			opts.Proto = probe.TCP
+		case "udp":
+			opts.Proto = probe.UDP
+			opts.UDPPort = udpPort
+		}
+	case "grpc":
+		if transfer() || oneWay {
+			configError("-proto grpc can't be used with -download, -upload or -one-way")
+		}
+		opts.Proto = probe.GRPC
+	default:
+		configError(fmt.Sprintf("protocol %q is not supported", proto))
+	}
+	switch httpVersion {
+	case "":
+	case "1.1", "2", "3":
+		if proto != "http" {
+			configError("-http can only be used with -proto http")
+		}
+		opts.HTTPVersion = map[string]probe.HTTPVersion{"1.1": probe.HTTP1, "2": probe.HTTP2, "3": probe.HTTP3}[httpVersion]
+	default:
+		configError(fmt.Sprintf("HTTP version %q is not supported", httpVersion))
+	}
+	switch {
+	case *ipv4 && (*ipv6 || family != ""), *ipv6 && family != "":
+		configError("-4, -6 and -family can't be used together")
+	case *ipv4:
+		family = "4"
+	case *ipv6:
+		family = "6"
+	}
+	switch family {
+	case "":
+	case "4":
+		opts.Family = probe.IPv4
+	case "6":
+		opts.Family = probe.IPv6
+	case "both":
+		if top > 0 || watchMode || metricsAddr != "" || format == "ndjson" || format == "nagios" || mode == "both" || oneWay {
+			configError("-family both can't be used with -top, -watch, -serve-metrics, -mode both, -one-way or -format ndjson or nagios")
+		}
+	default:
+		configError(fmt.Sprintf("family %q is not supported", family))
+	}
+
+	endpoints, err = config.Filter(endpoints, config.SplitList(include), config.SplitList(exclude))
+	if err != nil {
+		configError(err.Error())
+	}
+
+	regions := config.SplitList(region)
+	if len(regions) > 0 {
+		selected := make(map[string]config.Endpoint, len(regions))
+		for _, r := range regions {
+			e, found := endpoints[r]
+			if !found {
+				configError(fmt.Sprintf("region %q is not supported or does not exist", r))
+			}
+			selected[r] = e
+		}
+		endpoints = selected
+	}
+	if proto == "grpc" {
+		var skipped []string
+		endpoints, skipped = grpcEndpoints(endpoints)
+		if len(endpoints) == 0 {
+			configError("-proto grpc: no selected region has a gRPC URL in the endpoint list")
+		}
+		if len(skipped) > 0 {
+			fmt.Fprintf(os.Stderr, "warning: skipping regions without a gRPC URL: %s\n", strings.Join(skipped, ", "))
+		}
+	}
+	if err := checkThresholdRegions(endpoints); err != nil {
+		configError(err.Error())
+	}
+
+	if metricsAddr != "" {
+		if watchMode {
+			configError("-serve-metrics can't be used with -watch")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		opts.Number = 1
+		p := probe.New(&opts)
+		defer p.Close()
+		if err := serveMetrics(ctx, metricsAddr, p, endpoints, interval); err != nil {
+			configError(err.Error())
 		}
+		return
 	}
 
-	client = &http.Client{
-		Timeout: timeout,
+	if watchMode {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		opts.Number = 1
+		p := probe.New(&opts)
+		defer p.Close()
+		watch(ctx, p, endpoints, interval)
+		return
 	}
 
-	w := &worker{}
-	go w.start()
+	if mode == "both" {
+		opts.Mode = probe.Cold
+		cold, err := probe.New(&opts).Collect(context.Background(), endpoints, printResult)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitProbe)
+		}
+		opts.Mode = probe.Warm
+		warm, err := probe.New(&opts).Collect(context.Background(), endpoints, printResult)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(exitProbe)
+		}
+		reportBoth(cold, warm)
+		os.Exit(max(checkThresholds(cold, "cold"), checkThresholds(warm, "warm")))
+	}
+
+	if family == "both" {
+		var v4, v6 []*probe.Summary
+		for _, f := range []probe.Family{probe.IPv4, probe.IPv6} {
+			opts.Family = f
+			p := probe.New(&opts)
+			sorted, err := p.Collect(context.Background(), endpoints, printResult)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(exitProbe)
+			}
+			p.Close()
+			if f == probe.IPv4 {
+				v4 = sorted
+			} else {
+				v6 = sorted
+			}
+		}
+		reportFamilies(v4, v6)
+		os.Exit(max(checkThresholds(v4, "IPv4"), checkThresholds(v6, "IPv6")))
+	}
+
+	p := probe.New(&opts)
+	sorted, err := p.Collect(context.Background(), endpoints, printResult)
+	if err != nil {
+		if format == "nagios" {
+			exitUnknown(err.Error())
+		}
+		fmt.Println(err)
+		os.Exit(exitProbe)
+	}
+	p.Close()
 
 	switch {
-	case region != "":
-		w.reportRegion(endpoints, region)
-	case top:
-		w.reportTop(endpoints)
+	case format == "json":
+		reportJSON(sorted)
+	case format == "ndjson":
+		// Results were printed as they completed.
+	case format == "nagios":
+		os.Exit(reportNagios(sorted))
+	case top > 0:
+		reportTop(sorted, int(top))
+	case len(regions) == 1:
+		reportRegion(sorted)
 	case csvCum:
-		w.reportCSV(endpoints)
+		reportCSV(sorted)
 	default:
-		w.reportAll(endpoints)
+		reportAll(sorted)
+	}
+	os.Exit(checkThresholds(sorted, ""))
+}
+
+// parseFlags parses args into the flags. On errors, it prints the usage
+// and exits, or reports the error as UNKNOWN with -format nagios.
+func parseFlags(args []string) {
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	flag.CommandLine.Usage = func() {}
+	err := flag.CommandLine.Parse(args)
+	switch {
+	case err == flag.ErrHelp:
+		usage()
+		os.Exit(0)
+	case err == nil:
+		return
+	}
+	// Parsing stops at the error, possibly before -format.
+	if formatArg(args) == "nagios" {
+		exitUnknown(err.Error())
+	}
+	fmt.Println(err)
+	usage()
+	os.Exit(exitConfig)
+}
+
+// formatArg returns the value of -format in args, if any.
+func formatArg(args []string) string {
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		if v, ok := strings.CutPrefix(name, "format="); ok && name != a {
+			return v
+		}
+		if name == "format" && name != a && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// configError prints msg and exits with exitConfig, or reports msg as
+// UNKNOWN with -format nagios.
+func configError(msg string) {
+	if format == "nagios" {
+		exitUnknown(msg)
 	}
+	fmt.Println(msg)
+	os.Exit(exitConfig)
+}
+
+// grpcEndpoints returns the endpoints of em that have a gRPC URL, and the
+// sorted regions of the others.
+func grpcEndpoints(em map[string]config.Endpoint) (map[string]config.Endpoint, []string) {
+	selected := make(map[string]config.Endpoint, len(em))
+	var skipped []string
+	for r, e := range em {
+		if e.GRPCURL == "" {
+			skipped = append(skipped, r)
+			continue
+		}
+		selected[r] = e
+	}
+	sort.Strings(skipped)
+	return selected, skipped
+}
+
+// loadEndpoints reads the endpoint map from -endpoints-file if set.
+// Otherwise it fetches the map from -url, falling back to the built-in map
+// if the server can't be reached.
+func loadEndpoints() (map[string]config.Endpoint, error) {
+	if endpointFile != "" {
+		return config.EndpointsFromFile(endpointFile)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Fetch and cache endpoint map in memory for the duration of the
+	// process, and on disk for cacheTTL.
+	fetch := config.EndpointsFromServer
+	if dir, err := os.UserCacheDir(); err == nil && cacheTTL > 0 {
+		c := &config.Cache{Dir: filepath.Join(dir, "gcping"), TTL: cacheTTL}
+		fetch = c.EndpointsFromServer
+	}
+	endpoints, err := fetch(ctx, endpointsURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v; using built-in endpoint list\n", err)
+		return config.AllEndpoints, nil
+	}
+	return endpoints, nil
+}
+
+// topFlag is the -top flag. It is a boolean flag for compatibility, so
+// "-top" means 1, while "-top=N" selects the N best regions.
+type topFlag int
+
+func (t *topFlag) String() string {
+	return strconv.Itoa(int(*t))
+}
+
+func (t *topFlag) Set(s string) error {
+	if b, err := strconv.ParseBool(s); err == nil {
+		*t = 0
+		if b {
+			*t = 1
+		}
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid number of regions %q", s)
+	}
+	*t = topFlag(n)
+	return nil
+}
+
+func (t *topFlag) IsBoolFlag() bool { return true }
+
+// count handles "-top N". -top is also a boolean flag, so the flag
+// package leaves N as the first of args and stops parsing there. If -top
+// is set and args starts with a number, count sets t to it and returns
+// the arguments left to parse.
+func (t *topFlag) count(args []string) ([]string, error) {
+	if *t == 0 || len(args) == 0 {
+		return args, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return args, nil
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("-top %s selects no regions", args[0])
+	}
+	*t = topFlag(n)
+	return args[1:], nil
 }
 
 func usage() {
 	fmt.Println(usageText)
-	os.Exit(0)
 }
 
 var usageText = `gcping [options...]
 
 Options:
 -n       Number of requests to be made to each region.
-         By default 10; can't be negative.
+         By default 10; can't be negative or zero.
 -c       Max number of requests to be made at any time.
          By default 10; can't be negative or zero.
--r       Report latency for an individual region.
+-r       Report latency for an individual region, or a ranked report
+         for a comma-separated list of regions.
+-include Comma-separated regions to report; all by default. Accepts
+         region names, globs ("europe-*"), region prefixes ("europe"),
+         continents ("americas", "europe", "asia", "oceania",
+         "middleeast", "africa") and "!" to exclude ("!global").
+-exclude Comma-separated regions not to report, in the same format as
+         -include.
 -t       Timeout. By default, no timeout.
          Examples: "500ms", "1s", "1s500ms".
--top     If true, only the top (non-global) region is printed.
+-top     If set, only the top (non-global) region is printed.
+         "-top N" prints the N best regions, one per line.
+-latency With -top, also print the median latency of each region.
+-watch   Ping every region once per -interval and redraw a live report
+         of recent latencies until interrupted.
+-interval
+         Time between rounds of -watch and -serve-metrics. By default 5s.
+-mode    How connections are reused: "cold" opens a new connection for
+         every request, "warm" measures over established connections,
+         and "both" reports cold and warm latency side by side. By
+         default, connections are reused when possible.
+-include-cold-starts
+         Include requests served by a new instance in the stats. By
+         default, cold starts are only counted.
+-download, -upload
+         Measure throughput by downloading or uploading this many bytes
+         per request instead of sending a ping. The ping server only
+         serves them with THROUGHPUT=true, which tools/terraform doesn't
+         set, so they need regions from -endpoints-file or -url.
+-proto   Protocol used to ping regions: "http" sends an HTTP request
+         per ping; "ws" opens a WebSocket connection to each region and
+         measures message round trips over it; "grpc" calls the gRPC
+         health service of each region; "tcp" only measures the TCP
+         handshake, closing the connection right away; "udp" sends
+         packets to the UDP echo server of each region and also reports
+         packet loss and reordering. By default "http".
+         grpc pings the gRPC URL (GRPCURL) of each region in the
+         endpoint list, a service with HTTP/2 end to end, and skips
+         regions without one, such as global.
+-udp-port
+         Port of the UDP echo server of regions with -proto udp. By
+         default 8081.
+-4, -6   Only connect to the IPv4 or IPv6 addresses of regions.
+-family  "4" or "6" is the same as -4 or -6; "both" pings every region
+         over IPv4, then IPv6, and reports them side by side with the
+         addresses pinged. By default, the dialer picks either family
+         per connection.
+-http    HTTP version of -proto http: "1.1", "2" or "3" (QUIC). HTTP/2
+         is used without TLS (h2c) for http URLs, and HTTP/3 requires
+         https. The negotiated protocol is reported per region. By
+         default, HTTP/2 is negotiated for https URLs when possible.
+-one-way Exchange timestamps with each region instead of sending a ping,
+         and report the estimated clock offset and median upstream and
+         downstream delays. As with NTP, routes are assumed symmetric
+         for the fastest exchange, so a constant asymmetry is reported
+         as clock offset.
 -csv-cum If true, cumulative value is printed in CSV; disables default report.
 -url     URL of endpoint list. Default is https://global.gcping.com/api/endpoints
+         If it can't be fetched, the endpoint list built into gcping is used.
+-endpoints-file
+         Read the endpoint list from a file instead of -url. The file has
+         the same JSON format as the -url response.
+-cache-ttl How long the endpoint list fetched from -url is cached on disk
+         before it is revalidated. By default 24h; 0 disables the cache.
+
+-format  Output format: "text", "json", "ndjson" or "nagios". By default
+         "text". json prints a single document with per-region stats and
+         samples once all pings complete; ndjson prints one line per ping
+         as it completes; nagios prints a Nagios plugin status line and
+         exits with the plugin state, which is UNKNOWN for invalid flags
+         and unreachable regions. Disables -csv and verbose output.
+-warning, -critical
+         With -format nagios, the median latency at which a region is
+         WARNING or CRITICAL. Accepts per-region limits like -max-median.
+-max-median, -max-p95
+         Fail if the median or p95 latency of a region exceeds this
+         duration. Accepts a limit for all regions and per-region limits,
+         e.g. "80ms,us-central1=50ms".
+-max-error-rate
+         Fail if the fraction of failed pings of a region exceeds this
+         ratio, e.g. "0.05" or "5%". Accepts per-region limits like
+         -max-median.
+         With -mode both and -family both, the -max-* flags apply to
+         each run. Per-region limits must name regions that are pinged.
+         They can't be used with -watch, -serve-metrics or -format
+         nagios, which uses -warning and -critical instead.
+
+-serve-metrics
+         Serve Prometheus metrics on this address, e.g. ":9100", and ping
+         every region once per -interval until interrupted. Exports a
+         latency histogram, error counters by class, last success
+         timestamps and cold start counters per region.
 
 -csv     CSV output; disables verbose output.
 -v       Verbose output.
+-phases  If true, median DNS, TCP connect, TLS handshake and time to
+         first byte are reported per region, along with the time spent
+         in the server and the network RTT (total minus server time).
+         Each median is over the requests that went through the phase,
+         e.g. only those that opened a connection.
+-stats   Comma-separated statistics reported per region in the table
+         and -csv-cum output. By default "median". Available: min, max,
+         mean, stddev, median, p50, p90, p95, p99, jitter.
+
+Exit status is 0 on success, 1 if a -max-* threshold is breached,
+2 on invalid flags or endpoints, and 3 if -max-* flags are set and all
+pings to a region failed. With -format nagios, it is the plugin state.
 
 Need a website version? See gcping.com
 `
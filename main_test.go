@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGRPCEndpoints(t *testing.T) {
+	t.Parallel()
+
+	em := map[string]config.Endpoint{
+		"global":      {URL: "https://global.gcping.com"},
+		"us-east1":    {URL: "https://us-east1.run.app", GRPCURL: "https://us-east1-grpc.run.app"},
+		"us-west1":    {URL: "https://us-west1.run.app"},
+		"us-central1": {URL: "https://us-central1.run.app", GRPCURL: "https://us-central1-grpc.run.app"},
+	}
+	got, skipped := grpcEndpoints(em)
+	want := map[string]config.Endpoint{
+		"us-east1":    em["us-east1"],
+		"us-central1": em["us-central1"],
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("grpcEndpoints() endpoints (-want, +got):\n%s", diff)
+	}
+	if want := []string{"global", "us-west1"}; !slices.Equal(skipped, want) {
+		t.Errorf("grpcEndpoints() skipped %q, want %q", skipped, want)
+	}
+}
+
+func TestTopFlag(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		args        string
+		wantTop     int
+		wantLatency bool
+		wantArgs    []string
+		wantErr     bool
+	}{
+		{"", 0, false, nil, false},
+		{"-top", 1, false, nil, false},
+		{"-top=true", 1, false, nil, false},
+		{"-top=false", 0, false, nil, false},
+		{"-top=0", 0, false, nil, false},
+		{"-top=3 -latency", 3, true, nil, false},
+		{"-top 3 -latency", 3, true, nil, false},
+		{"-top -latency", 1, true, nil, false},
+		{"-top 0 -latency", 0, false, nil, true},
+		{"-top -2", 0, false, nil, true},
+		{"-top=-2", 0, false, nil, true},
+		{"-top x -latency", 1, false, []string{"x", "-latency"}, false},
+	}
+	for _, tc := range testCases {
+		var top topFlag
+		var latency bool
+		fs := flag.NewFlagSet("gcping", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Var(&top, "top", "")
+		fs.BoolVar(&latency, "latency", false, "")
+
+		err := fs.Parse(strings.Fields(tc.args))
+		if err == nil {
+			var args []string
+			args, err = top.count(fs.Args())
+			if err == nil && len(args) < fs.NArg() {
+				err = fs.Parse(args)
+			}
+		}
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%q: got -top %d, want error", tc.args, top)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: failed: %v", tc.args, err)
+			continue
+		}
+		if int(top) != tc.wantTop || latency != tc.wantLatency || !slices.Equal(fs.Args(), tc.wantArgs) {
+			t.Errorf("%q: got -top %d, -latency %v, args %q, want %d, %v, %q", tc.args, top, latency, fs.Args(), tc.wantTop, tc.wantLatency, tc.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/probe"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// exporter holds the Prometheus metrics of -serve-metrics.
+type exporter struct {
+	latency     *prometheus.HistogramVec
+	errors      *prometheus.CounterVec
+	lastSuccess *prometheus.GaugeVec
+	coldStarts  *prometheus.CounterVec
+}
+
+func newExporter(reg prometheus.Registerer) *exporter {
+	e := &exporter{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gcping_latency_seconds",
+			Help:    "Latency of successful pings.",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"region", "region_name"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gcping_errors_total",
+			Help: "Number of failed pings by error class: timeout, dns, connect, tls, http, rpc or other.",
+		}, []string{"region", "region_name", "class"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gcping_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful ping.",
+		}, []string{"region", "region_name"}),
+		coldStarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gcping_cold_starts_total",
+			Help: "Number of pings served by a new instance.",
+		}, []string{"region", "region_name"}),
+	}
+	reg.MustRegister(e.latency, e.errors, e.lastSuccess, e.coldStarts)
+	return e
+}
+
+// observe records the result of a single ping.
+func (e *exporter) observe(r probe.Result) {
+	region, name := r.Region, r.Endpoint.RegionName
+	if r.Err != nil {
+		e.errors.WithLabelValues(region, name, probe.ErrorClass(r.Err)).Inc()
+		return
+	}
+	e.lastSuccess.WithLabelValues(region, name).SetToCurrentTime()
+	if r.ColdStart {
+		e.coldStarts.WithLabelValues(region, name).Inc()
+		if !coldStarts {
+			return
+		}
+	}
+	e.latency.WithLabelValues(region, name).Observe(r.Duration.Seconds())
+}
+
+// serveMetrics serves Prometheus metrics on addr and pings every endpoint
+// once per interval until ctx is done.
+func serveMetrics(ctx context.Context, addr string, p *probe.Prober, em map[string]probe.Endpoint, interval time.Duration) error {
+	reg := prometheus.NewRegistry()
+	e := newExporter(reg)
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitProbe)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "Serving metrics on http://%v/metrics\n", l.Addr())
+
+	repeat(ctx, interval, func(int) error {
+		return p.Run(ctx, em, func(r probe.Result) {
+			e.observe(r)
+			printResult(r)
+		})
+	})
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
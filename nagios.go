@@ -0,0 +1,120 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+// Nagios plugin states, which are also the exit codes of the plugin.
+const (
+	nagiosOK       = 0
+	nagiosWarning  = 1
+	nagiosCritical = 2
+	nagiosUnknown  = 3
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+var (
+	warning  = newDurationThreshold()
+	critical = newDurationThreshold()
+)
+
+// reportNagios prints a Nagios plugin status line with the median latency
+// of every region as perfdata, and returns the plugin state.
+func reportNagios(sorted []*probe.Summary) int {
+	state, line := nagiosStatus(sorted)
+	fmt.Println(line)
+	return state
+}
+
+// exitUnknown prints an UNKNOWN status line for msg, e.g. an invalid flag,
+// and exits with that state.
+func exitUnknown(msg string) {
+	fmt.Printf("GCPING %s - %s\n", nagiosStates[nagiosUnknown], msg)
+	os.Exit(nagiosUnknown)
+}
+
+// nagiosStatus returns the plugin state and status line of sorted.
+// Unreachable regions are UNKNOWN, and their perfdata value is "U".
+func nagiosStatus(sorted []*probe.Summary) (int, string) {
+	state := nagiosOK
+	var problems, perf []string
+	for _, s := range sorted {
+		med := s.Median()
+		warn, warnSet := warning.limit(s.Region)
+		crit, critSet := critical.limit(s.Region)
+
+		regionState := nagiosOK
+		switch {
+		case s.Failed():
+			regionState = nagiosUnknown
+			problems = append(problems, s.Region+" unreachable")
+		case critSet && float64(med) >= crit:
+			regionState = nagiosCritical
+			problems = append(problems, fmt.Sprintf("%s %v >= %v", s.Region, med, time.Duration(crit)))
+		case warnSet && float64(med) >= warn:
+			regionState = nagiosWarning
+			problems = append(problems, fmt.Sprintf("%s %v >= %v", s.Region, med, time.Duration(warn)))
+		}
+		state = worseState(state, regionState)
+
+		p := fmt.Sprintf("%s=%sms;", s.Region, milliseconds(float64(med)))
+		if s.Failed() {
+			p = s.Region + "=U;"
+		}
+		if warnSet {
+			p += milliseconds(warn)
+		}
+		p += ";"
+		if critSet {
+			p += milliseconds(crit)
+		}
+		perf = append(perf, p+";0")
+	}
+
+	var summary string
+	switch {
+	case len(sorted) == 0:
+		state = nagiosUnknown
+		summary = "no regions probed"
+	case len(problems) > 0:
+		summary = strings.Join(problems, ", ")
+	default:
+		summary = fmt.Sprintf("%d regions, fastest %s %v", len(sorted), sorted[0].Region, sorted[0].Median())
+	}
+	return state, fmt.Sprintf("GCPING %s - %s | %s", nagiosStates[state], summary, strings.Join(perf, " "))
+}
+
+// worseState returns the more severe of two plugin states. UNKNOWN is less
+// severe than CRITICAL but more severe than WARNING.
+func worseState(a, b int) int {
+	rank := map[int]int{nagiosOK: 0, nagiosWarning: 1, nagiosUnknown: 2, nagiosCritical: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// milliseconds formats nanoseconds as milliseconds.
+func milliseconds(ns float64) string {
+	return fmt.Sprintf("%.3f", ns/float64(time.Millisecond))
+}
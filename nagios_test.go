@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+func TestWorseState(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		a, b int
+		want int
+	}{
+		{nagiosOK, nagiosOK, nagiosOK},
+		{nagiosOK, nagiosWarning, nagiosWarning},
+		{nagiosWarning, nagiosOK, nagiosWarning},
+		{nagiosWarning, nagiosUnknown, nagiosUnknown},
+		{nagiosUnknown, nagiosWarning, nagiosUnknown},
+		{nagiosUnknown, nagiosCritical, nagiosCritical},
+		{nagiosCritical, nagiosUnknown, nagiosCritical},
+		{nagiosCritical, nagiosWarning, nagiosCritical},
+	}
+	for _, tc := range testCases {
+		if got := worseState(tc.a, tc.b); got != tc.want {
+			t.Errorf("worseState(%s, %s) = %s, want %s", nagiosStates[tc.a], nagiosStates[tc.b], nagiosStates[got], nagiosStates[tc.want])
+		}
+	}
+}
+
+// TestNagiosStatus sets the global -warning and -critical flags, so it
+// isn't parallel.
+func TestNagiosStatus(t *testing.T) {
+	setThreshold(t, warning, "10ms,slow=100ms")
+	setThreshold(t, critical, "50ms")
+
+	fast := &probe.Summary{Region: "fast", Durations: []time.Duration{time.Millisecond}}
+	warm := &probe.Summary{Region: "warm", Durations: []time.Duration{20 * time.Millisecond}}
+	slow := &probe.Summary{Region: "slow", Durations: []time.Duration{60 * time.Millisecond}}
+	dead := &probe.Summary{Region: "dead", Durations: []time.Duration{time.Millisecond}, Errors: 1}
+
+	testCases := []struct {
+		name      string
+		summaries []*probe.Summary
+		wantState int
+		wantLine  string
+	}{
+		{
+			"ok",
+			[]*probe.Summary{fast},
+			nagiosOK,
+			"GCPING OK - 1 regions, fastest fast 1ms | fast=1.000ms;10.000;50.000;0",
+		},
+		{
+			"warning",
+			[]*probe.Summary{fast, warm},
+			nagiosWarning,
+			"GCPING WARNING - warm 20ms >= 10ms | fast=1.000ms;10.000;50.000;0 warm=20.000ms;10.000;50.000;0",
+		},
+		{
+			"unknown over warning",
+			[]*probe.Summary{warm, dead},
+			nagiosUnknown,
+			"GCPING UNKNOWN - warm 20ms >= 10ms, dead unreachable | warm=20.000ms;10.000;50.000;0 dead=U;10.000;50.000;0",
+		},
+		{
+			"critical over unknown",
+			[]*probe.Summary{slow, dead},
+			nagiosCritical,
+			"GCPING CRITICAL - slow 60ms >= 50ms, dead unreachable | slow=60.000ms;100.000;50.000;0 dead=U;10.000;50.000;0",
+		},
+		{
+			"no regions",
+			nil,
+			nagiosUnknown,
+			"GCPING UNKNOWN - no regions probed | ",
+		},
+	}
+	for _, tc := range testCases {
+		state, line := nagiosStatus(tc.summaries)
+		if state != tc.wantState || line != tc.wantLine {
+			t.Errorf("%s: nagiosStatus() = %s, %q, want %s, %q", tc.name, nagiosStates[state], line, nagiosStates[tc.wantState], tc.wantLine)
+		}
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	t.Parallel()
+
+	if got, want := milliseconds(float64(1500*time.Microsecond)), "1.500"; got != want {
+		t.Errorf("milliseconds(1.5ms) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Exchange is an NTP-style exchange of timestamps with an endpoint. Sent
+// and Received are read from the client clock, ServerReceived and
+// ServerSent from the server clock.
+type Exchange struct {
+	// Sent is when the request was written.
+	Sent time.Time
+	// ServerReceived is when the server received the request.
+	ServerReceived time.Time
+	// ServerSent is when the server sent the response.
+	ServerSent time.Time
+	// Received is when the first byte of the response arrived.
+	Received time.Time
+}
+
+// Delay returns the round trip time of the exchange, excluding the time
+// spent in the server.
+func (x Exchange) Delay() time.Duration {
+	return x.Received.Sub(x.Sent) - x.ServerSent.Sub(x.ServerReceived)
+}
+
+// Offset returns how far the server clock is ahead of the client clock,
+// assuming that the request and the response took the same time.
+func (x Exchange) Offset() time.Duration {
+	return (x.ServerReceived.Sub(x.Sent) + x.ServerSent.Sub(x.Received)) / 2
+}
+
+// OneWay is an estimate of the one-way delays to an endpoint.
+type OneWay struct {
+	// Offset is how far the server clock is ahead of the client clock.
+	Offset time.Duration
+	// Upstream is the median delay from the client to the server.
+	Upstream time.Duration
+	// Downstream is the median delay from the server to the client.
+	Downstream time.Duration
+}
+
+// EstimateOneWay estimates the clock offset and one-way delays from
+// several exchanges with the same endpoint. Like NTP, it takes the offset
+// of the exchange with the lowest delay, which is the least likely to be
+// skewed by queuing, and applies it to all exchanges. A constant asymmetry
+// of the route can't be told from a clock offset, so the estimates only
+// show asymmetry that varies across exchanges.
+func EstimateOneWay(xs []Exchange) OneWay {
+	if len(xs) == 0 {
+		return OneWay{}
+	}
+	best := xs[0]
+	for _, x := range xs[1:] {
+		if x.Delay() < best.Delay() {
+			best = x
+		}
+	}
+	offset := best.Offset()
+
+	up := make([]time.Duration, len(xs))
+	down := make([]time.Duration, len(xs))
+	for i, x := range xs {
+		up[i] = x.ServerReceived.Sub(x.Sent) - offset
+		down[i] = x.Received.Sub(x.ServerSent) + offset
+	}
+	return OneWay{
+		Offset:     offset,
+		Upstream:   median(up),
+		Downstream: median(down),
+	}
+}
+
+// median returns the median of d, which it sorts.
+func median(d []time.Duration) time.Duration {
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	return d[len(d)/2]
+}
+
+// timeResponse is the response of /api/time.
+type timeResponse struct {
+	Receive  int64 `json:"receive"`
+	Transmit int64 `json:"transmit"`
+}
+
+// parseExchange completes an exchange that was sent and received at the
+// given times with the server timestamps in body.
+func parseExchange(body string, sent, received time.Time) (Exchange, error) {
+	var tr timeResponse
+	if err := json.Unmarshal([]byte(body), &tr); err != nil || tr.Receive == 0 || tr.Transmit == 0 {
+		return Exchange{}, fmt.Errorf("invalid time response %q", body)
+	}
+	if sent.IsZero() || received.IsZero() {
+		return Exchange{}, fmt.Errorf("request or response time not recorded")
+	}
+	return Exchange{
+		Sent:           sent,
+		ServerReceived: time.Unix(0, tr.Receive),
+		ServerSent:     time.Unix(0, tr.Transmit),
+		Received:       received,
+	}, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/httphandler"
+)
+
+func TestEstimateOneWay(t *testing.T) {
+	t.Parallel()
+
+	// The server clock is 1s ahead and spends 1ms on each request.
+	t0 := time.Unix(1700000000, 0)
+	exchange := func(sent time.Time, up, down time.Duration) Exchange {
+		serverReceived := sent.Add(time.Second + up)
+		serverSent := serverReceived.Add(time.Millisecond)
+		return Exchange{
+			Sent:           sent,
+			ServerReceived: serverReceived,
+			ServerSent:     serverSent,
+			Received:       serverSent.Add(-time.Second + down),
+		}
+	}
+	xs := []Exchange{
+		exchange(t0, 25*time.Millisecond, 10*time.Millisecond),
+		// Lowest delay and symmetric, so it sets the offset.
+		exchange(t0.Add(time.Second), 10*time.Millisecond, 10*time.Millisecond),
+		exchange(t0.Add(2*time.Second), 20*time.Millisecond, 10*time.Millisecond),
+	}
+	if got, want := xs[0].Delay(), 35*time.Millisecond; got != want {
+		t.Errorf("Delay() = %v, want %v", got, want)
+	}
+
+	got := EstimateOneWay(xs)
+	want := OneWay{
+		Offset:     time.Second,
+		Upstream:   20 * time.Millisecond,
+		Downstream: 10 * time.Millisecond,
+	}
+	if got != want {
+		t.Errorf("EstimateOneWay() = %+v, want %+v", got, want)
+	}
+
+	if got := EstimateOneWay(nil); got != (OneWay{}) {
+		t.Errorf("EstimateOneWay(nil) = %+v, want zero", got)
+	}
+}
+
+func TestClock(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(httphandler.New(&httphandler.Options{Region: "test-region"}))
+	t.Cleanup(ts.Close)
+
+	p := New(&Options{Number: 5, Concurrency: 1, Clock: true, IncludeColdStarts: true})
+	summaries, err := p.Collect(context.Background(), map[string]Endpoint{"test-region": {URL: ts.URL}}, nil)
+	if err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+	s := summaries[0]
+	if s.Errors > 0 {
+		t.Fatalf("Collect() got %d errors", s.Errors)
+	}
+	if got, want := len(s.Exchanges), 5; got != want {
+		t.Fatalf("Collect() got %d exchanges, want %d", got, want)
+	}
+
+	// Client and server share a clock.
+	ow := s.OneWay()
+	if ow.Offset < -time.Millisecond || ow.Offset > time.Millisecond {
+		t.Errorf("OneWay().Offset = %v, want about 0", ow.Offset)
+	}
+	if ow.Upstream <= 0 || ow.Downstream <= 0 {
+		t.Errorf("OneWay() = %+v, want positive delays", ow)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"maps"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/config"
+)
+
+// DefaultEndpointsURL serves the endpoint list of the public gcping
+// deployment.
+const DefaultEndpointsURL = "https://global.gcping.com/api/endpoints"
+
+// Endpoints fetches the endpoint list served at url, e.g.
+// DefaultEndpointsURL, keyed by region.
+func Endpoints(ctx context.Context, url string) (map[string]Endpoint, error) {
+	return config.EndpointsFromServer(ctx, url)
+}
+
+// BuiltinEndpoints returns a copy of the endpoint list built into gcping,
+// for use when the list can't be fetched.
+func BuiltinEndpoints() map[string]Endpoint {
+	return maps.Clone(config.AllEndpoints)
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEndpoints(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"us-central1":{"URL":"https://us-central1.example.com","Region":"us-central1","RegionName":"Iowa"}}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	got, err := Endpoints(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("Endpoints() failed: %v", err)
+	}
+	want := map[string]Endpoint{
+		"us-central1": {URL: "https://us-central1.example.com", Region: "us-central1", RegionName: "Iowa"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Endpoints() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuiltinEndpoints(t *testing.T) {
+	t.Parallel()
+
+	em := BuiltinEndpoints()
+	if _, ok := em["global"]; !ok {
+		t.Fatal("BuiltinEndpoints() has no global endpoint")
+	}
+	// Callers may modify the returned map.
+	delete(em, "global")
+	if _, ok := BuiltinEndpoints()["global"]; !ok {
+		t.Error("BuiltinEndpoints() returned the shared map")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusError is returned when an endpoint responds with a status code
+// other than 200 OK.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status code: %v", e.Code)
+}
+
+// Error classes returned by ErrorClass. They are labels, not errors to
+// compare with errors.Is.
+const (
+	ClassTimeout = "timeout"
+	ClassDNS     = "dns"
+	ClassConnect = "connect"
+	ClassTLS     = "tls"
+	ClassHTTP    = "http"
+	ClassRPC     = "rpc"
+	ClassOther   = "other"
+)
+
+// ErrorClass classifies the error of a failed ping by the stage of the
+// request it happened in. It returns "" if err is nil.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	var (
+		netErr    net.Error
+		dnsErr    *net.DNSError
+		opErr     *net.OpError
+		statusErr *StatusError
+		headerErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+		certErr   *tls.CertificateVerificationError
+		unknownCA x509.UnknownAuthorityError
+		hostErr   x509.HostnameError
+		invalid   x509.CertificateInvalidError
+	)
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.DeadlineExceeded:
+			return ClassTimeout
+		case codes.Unavailable:
+			// The connection failed.
+			return ClassConnect
+		}
+		return ClassRPC
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrPacketLost),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	case errors.As(err, &dnsErr):
+		return ClassDNS
+	case errors.As(err, &headerErr), errors.As(err, &alertErr),
+		errors.As(err, &certErr), errors.As(err, &unknownCA),
+		errors.As(err, &hostErr), errors.As(err, &invalid):
+		return ClassTLS
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ClassConnect
+	case errors.As(err, &statusErr):
+		return ClassHTTP
+	}
+	return ClassOther
+}
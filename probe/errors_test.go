@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorClass(t *testing.T) {
+	t.Parallel()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	t.Cleanup(slow.Close)
+	// The certificate of the test server isn't trusted by the client.
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(untrusted.Close)
+
+	// Find a local port that nothing listens on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + l.Addr().String()
+	l.Close()
+
+	testCases := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"http", failing.URL, ClassHTTP},
+		{"timeout", slow.URL, ClassTimeout},
+		{"connect", closed, ClassConnect},
+		{"dns", "http://gcping.invalid", ClassDNS},
+		{"tls", untrusted.URL, ClassTLS},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Only the slow server should time out, even on a busy machine.
+			timeout := 5 * time.Second
+			if tc.want == ClassTimeout {
+				timeout = 100 * time.Millisecond
+			}
+			p := New(&Options{Timeout: timeout})
+			r := p.Ping(context.Background(), Endpoint{URL: tc.url})
+			if got := ErrorClass(r.Err); got != tc.want {
+				t.Errorf("ErrorClass(%v) = %q, want %q", r.Err, got, tc.want)
+			}
+		})
+	}
+
+	if got := ErrorClass(nil); got != "" {
+		t.Errorf("ErrorClass(nil) = %q, want empty", got)
+	}
+}
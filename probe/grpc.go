@@ -0,0 +1,124 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// newGRPCConn returns a gRPC client connection to e over addresses of
+// family f. Connections to https endpoints use TLS, others use HTTP/2
+// without TLS.
+func newGRPCConn(e Endpoint, f Family) (*grpc.ClientConn, error) {
+	host, port, err := hostPort(e)
+	if err != nil {
+		return nil, err
+	}
+	creds := insecure.NewCredentials()
+	if strings.HasPrefix(e.URL, "https:") {
+		creds = credentials.NewClientTLSFromCert(nil, "")
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUserAgent("GCPing-CLI"),
+	}
+	if f != AnyFamily {
+		var d net.Dialer
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, f.network("tcp"), addr)
+		}))
+	}
+	return grpc.NewClient(net.JoinHostPort(host, port), opts...)
+}
+
+// grpcEndpoint returns e with the URL of its gRPC service: GRPCURL if set,
+// otherwise URL for servers that serve gRPC next to HTTP/1.1.
+func grpcEndpoint(e Endpoint) Endpoint {
+	if e.GRPCURL != "" {
+		e.URL = e.GRPCURL
+	}
+	return e
+}
+
+// grpcConn returns the shared connection to e, creating it if needed. In
+// Cold mode, it returns a new connection that the caller must close.
+func (p *Prober) grpcConn(e Endpoint) (*grpc.ClientConn, error) {
+	if p.opts.Mode == Cold {
+		return newGRPCConn(e, p.opts.Family)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cc, ok := p.grpcConns[e.URL]; ok {
+		return cc, nil
+	}
+	cc, err := newGRPCConn(e, p.opts.Family)
+	if err != nil {
+		return nil, err
+	}
+	if p.grpcConns == nil {
+		p.grpcConns = make(map[string]*grpc.ClientConn)
+	}
+	p.grpcConns[e.URL] = cc
+	return cc, nil
+}
+
+// pingGRPC calls the gRPC health service of e at its GRPCURL, or its URL
+// if it has none, and measures the round trip.
+// Like HTTP requests, the first call on a connection includes connection
+// setup.
+func (p *Prober) pingGRPC(ctx context.Context, e Endpoint) Result {
+	r := Result{Region: e.Region, Endpoint: e}
+	cc, err := p.grpcConn(grpcEndpoint(e))
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if p.opts.Mode == Cold {
+		defer cc.Close()
+	}
+	if p.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+	}
+
+	var md metadata.MD
+	var pr peer.Peer
+	start := time.Now()
+	res, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&md), grpc.Peer(&pr))
+	r.Duration = time.Since(start)
+	if pr.Addr != nil {
+		r.Addr = ipOf(pr.Addr.String())
+	}
+	if err == nil && res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		err = fmt.Errorf("health status: %v", res.GetStatus())
+	}
+	if v := md.Get("x-first-request"); len(v) > 0 {
+		r.ColdStart = v[0] == "true"
+	}
+	r.Err = err
+	return r
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/httphandler"
+)
+
+func TestGRPC(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		mode Mode
+	}{
+		{"reuse", Reuse},
+		{"cold", Cold},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := httptest.NewUnstartedServer(httphandler.New(&httphandler.Options{Region: "test-region", GRPC: true}))
+			ts.Config.Protocols = new(http.Protocols)
+			ts.Config.Protocols.SetHTTP1(true)
+			ts.Config.Protocols.SetUnencryptedHTTP2(true)
+			ts.Start()
+			t.Cleanup(ts.Close)
+
+			p := New(&Options{Number: 3, Concurrency: 2, Mode: tc.mode, Proto: GRPC})
+			t.Cleanup(func() { p.Close() })
+			summaries, err := p.Collect(context.Background(), map[string]Endpoint{"test-region": {URL: ts.URL}}, func(r Result) {
+				if r.Err != nil {
+					t.Errorf("Collect() result error: %v", r.Err)
+				}
+			})
+			if err != nil {
+				t.Fatalf("Collect() failed: %v", err)
+			}
+			s := summaries[0]
+			if got, want := s.ColdStarts, 1; got != want {
+				t.Errorf("Collect() got %d cold starts, want %d", got, want)
+			}
+			if got, want := len(s.Durations), 2; got != want {
+				t.Errorf("Collect() got %d durations, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestGRPCURL(t *testing.T) {
+	t.Parallel()
+
+	// The gRPC service is separate from the HTTP/1.1 one.
+	ts := httptest.NewUnstartedServer(httphandler.New(&httphandler.Options{Region: "test-region", GRPC: true}))
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	plain := httptest.NewServer(httphandler.New(&httphandler.Options{Region: "test-region"}))
+	t.Cleanup(plain.Close)
+
+	p := New(&Options{Proto: GRPC})
+	t.Cleanup(func() { p.Close() })
+	e := Endpoint{URL: plain.URL, GRPCURL: ts.URL}
+	r := p.Ping(context.Background(), e)
+	if r.Err != nil {
+		t.Fatalf("Ping() failed: %v", r.Err)
+	}
+	if r.Endpoint != e {
+		t.Errorf("Ping() result endpoint = %v, want %v", r.Endpoint, e)
+	}
+}
+
+func TestGRPCUnavailable(t *testing.T) {
+	t.Parallel()
+
+	// The server doesn't speak gRPC.
+	ts := httptest.NewServer(httphandler.New(&httphandler.Options{Region: "test-region"}))
+	t.Cleanup(ts.Close)
+
+	p := New(&Options{Proto: GRPC})
+	t.Cleanup(func() { p.Close() })
+	r := p.Ping(context.Background(), Endpoint{URL: ts.URL})
+	if r.Err == nil {
+		t.Fatal("Ping() succeeded, want error")
+	}
+	if got, want := ErrorClass(r.Err), ClassConnect; got != want {
+		t.Errorf("ErrorClass(%v) = %q, want %q", r.Err, got, want)
+	}
+}
@@ -0,0 +1,518 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package probe measures the latency to gcping endpoints. It is the
+// measurement code behind the gcping command line tool.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/config"
+	"github.com/quic-go/quic-go/http3"
+	"google.golang.org/grpc"
+)
+
+// Endpoint is a gcping service deployed in a region, as served by
+// /api/endpoints.
+type Endpoint = config.Endpoint
+
+// Mode selects how connections are reused across requests.
+type Mode int
+
+const (
+	// Reuse reuses connections as the HTTP client sees fit. The first
+	// request to each endpoint includes DNS lookup, TCP and TLS handshakes
+	// while later requests usually do not.
+	Reuse Mode = iota
+	// Cold opens a new connection for every request.
+	Cold
+	// Warm sends a discarded request to each endpoint before measuring, so
+	// that measured requests run over established connections.
+	Warm
+)
+
+// Proto is the protocol used to ping endpoints.
+type Proto int
+
+const (
+	// HTTP sends an HTTP request for every ping.
+	HTTP Proto = iota
+	// WebSocket opens a WebSocket connection to each endpoint and sends a
+	// message over it for every ping. Mode, Download, Upload and Clock
+	// don't apply.
+	WebSocket
+	// GRPC calls the gRPC health service of each endpoint for every ping.
+	// Download, Upload and Clock don't apply.
+	GRPC
+	// TCP opens a TCP connection to each endpoint for every ping and
+	// measures the handshake only. Mode, Download, Upload and Clock don't
+	// apply.
+	TCP
+	// UDP sends a packet to the UDP echo server of each endpoint, on
+	// UDPPort, for every ping. Lost packets fail with ErrPacketLost. Mode,
+	// Download, Upload and Clock don't apply.
+	UDP
+)
+
+// HTTPVersion is the HTTP version used by HTTP pings.
+type HTTPVersion int
+
+const (
+	// HTTPAuto lets the client negotiate HTTP/2 with https endpoints and
+	// use HTTP/1.1 otherwise.
+	HTTPAuto HTTPVersion = iota
+	// HTTP1 uses HTTP/1.1.
+	HTTP1
+	// HTTP2 uses HTTP/2, over TLS with https endpoints and without TLS
+	// (h2c) otherwise.
+	HTTP2
+	// HTTP3 uses HTTP/3 over QUIC. Endpoints must use https. The connect
+	// and TLS phases both span the QUIC handshake.
+	HTTP3
+)
+
+// Family is the IP address family used to reach endpoints.
+type Family int
+
+const (
+	// AnyFamily lets the dialer pick addresses of either family, racing
+	// them as in Happy Eyeballs.
+	AnyFamily Family = iota
+	// IPv4 only connects to IPv4 addresses.
+	IPv4
+	// IPv6 only connects to IPv6 addresses.
+	IPv6
+)
+
+// Options contains parameters for Prober.
+type Options struct {
+	// Number is the number of requests made to each endpoint by Run.
+	// By default 10.
+	Number int
+	// Concurrency is the maximum number of requests in flight.
+	// By default 10.
+	Concurrency int
+	// Timeout is the timeout of a single request. By default, no timeout.
+	Timeout time.Duration
+	// Mode selects how connections are reused. By default, Reuse.
+	Mode Mode
+	// Proto is the protocol used to ping endpoints. By default, HTTP.
+	Proto Proto
+	// HTTPVersion is the HTTP version used in HTTP mode. By default,
+	// HTTPAuto.
+	HTTPVersion HTTPVersion
+	// Family restricts the addresses connected to. By default, AnyFamily.
+	Family Family
+	// UDPPort is the port of the UDP echo server of endpoints in UDP mode.
+	// By default, 8081.
+	UDPPort int
+	// Download, if positive, makes every request download this many bytes
+	// to measure throughput instead of sending a ping.
+	Download int64
+	// Upload, if positive, makes every request upload this many bytes to
+	// measure throughput instead of sending a ping. Download takes
+	// precedence.
+	Upload int64
+	// Clock, if set, makes every request exchange timestamps with the
+	// endpoint instead of sending a ping, to estimate the clock offset and
+	// one-way delays. See EstimateOneWay.
+	Clock bool
+	// IncludeColdStarts includes requests served by a new instance in the
+	// summaries returned by Collect. By default, they are only counted.
+	IncludeColdStarts bool
+	// Client is the HTTP client used for requests. If nil, a client with
+	// Timeout, configured for Mode, HTTPVersion and Family, is created. A
+	// custom client is used as is, so its transport must honor them.
+	Client *http.Client
+	// BeforePing, if set, is called by Run before each ping it measures,
+	// with the endpoint about to be pinged. It may be called concurrently.
+	BeforePing func(e Endpoint)
+}
+
+// Result is the outcome of a single ping.
+type Result struct {
+	// Region is the region of the endpoint, e.g., us-central1.
+	Region string
+	// Endpoint is the endpoint that was pinged.
+	Endpoint Endpoint
+	// Duration is the total latency of the request.
+	Duration time.Duration
+	// Phases breaks Duration down into the stages of the request.
+	Phases Phases
+	// Bytes is the size of the payload transferred in a throughput test.
+	Bytes int64
+	// Protocol is the protocol negotiated for an HTTP request, e.g.
+	// "HTTP/2.0". It is empty if the request failed before a response.
+	Protocol string
+	// Addr is the IP address the ping was sent to, if known.
+	Addr string
+	// ColdStart is true if the request was the first served by the
+	// instance, as reported by the X-First-Request header. Cold starts are
+	// usually much slower than other requests.
+	ColdStart bool
+	// Exchange holds the timestamps of the request in Clock mode.
+	Exchange Exchange
+	// Reordered is true in UDP mode if the echo arrived after the echo of
+	// a later packet.
+	Reordered bool
+	// Err is non-nil if the request failed.
+	Err error
+}
+
+// Prober pings gcping endpoints.
+type Prober struct {
+	opts   Options
+	client *http.Client
+	h3     *http3.Transport // transport of client with HTTP3
+
+	mu        sync.Mutex
+	sockets   map[string]*wsConn          // keyed by endpoint URL
+	grpcConns map[string]*grpc.ClientConn // keyed by endpoint URL
+	udpConns  map[string]*udpConn         // keyed by endpoint URL
+}
+
+// New returns a new instance of Prober based on opts.
+func New(opts *Options) *Prober {
+	p := &Prober{
+		opts: *opts,
+	}
+	if p.opts.Number <= 0 {
+		p.opts.Number = 10
+	}
+	if p.opts.Concurrency <= 0 {
+		p.opts.Concurrency = 10
+	}
+	p.client = p.opts.Client
+	if p.client == nil {
+		p.client = &http.Client{
+			Timeout: p.opts.Timeout,
+		}
+		if p.opts.HTTPVersion == HTTP3 {
+			p.h3 = newH3Transport(p.opts.Family)
+			p.client.Transport = p.h3
+		} else if p.opts.Mode != Reuse || p.opts.HTTPVersion != HTTPAuto || p.opts.Family != AnyFamily {
+			p.client.Transport = newTransport(p.opts)
+		}
+	}
+	return p
+}
+
+// Ping sends a single request to e and measures its latency. If Download
+// or Upload is set, the request transfers a payload of that size instead.
+// If Clock is set, the request exchanges timestamps with e.
+func (p *Prober) Ping(ctx context.Context, e Endpoint) Result {
+	switch p.opts.Proto {
+	case WebSocket:
+		return p.pingWS(ctx, e)
+	case GRPC:
+		return p.pingGRPC(ctx, e)
+	case TCP:
+		return p.pingTCP(ctx, e)
+	case UDP:
+		return p.pingUDP(ctx, e)
+	}
+
+	t := &tracer{}
+	ctx = httptrace.WithClientTrace(ctx, t.clientTrace())
+
+	start := time.Now()
+	res, body, n, err := p.send(ctx, e)
+	duration := time.Since(start)
+
+	var h http.Header
+	var protocol string
+	if res != nil {
+		h, protocol = res.Header, res.Proto
+	}
+
+	var x Exchange
+	if p.opts.Clock && err == nil {
+		sent, received := t.requestTimes()
+		x, err = parseExchange(body, sent, received)
+	}
+
+	phases := t.phases()
+	if st := serverTime(h); st > 0 && st < duration {
+		phases.Server = st
+		phases.Network = duration - st
+	}
+	return Result{
+		Region:    e.Region,
+		Endpoint:  e,
+		Duration:  duration,
+		Phases:    phases,
+		Bytes:     n,
+		Protocol:  protocol,
+		Addr:      t.remoteAddr(),
+		ColdStart: h.Get("X-First-Request") == "true",
+		Exchange:  x,
+		Err:       err,
+	}
+}
+
+// send sends a request to e and returns the response, the start of its body
+// and the number of payload bytes transferred. The response body is closed.
+func (p *Prober) send(ctx context.Context, e Endpoint) (*http.Response, string, int64, error) {
+	method, url := http.MethodGet, e.URL+"/api/ping"
+	var body io.Reader
+	switch {
+	case p.opts.Download > 0:
+		url = fmt.Sprintf("%s/api/download?bytes=%d", e.URL, p.opts.Download)
+	case p.opts.Upload > 0:
+		method, url = http.MethodPost, e.URL+"/api/upload"
+		body = io.LimitReader(zeros{}, p.opts.Upload)
+	case p.opts.Clock:
+		url = e.URL + "/api/time"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if body != nil {
+		req.ContentLength = p.opts.Upload
+	}
+	req.Header.Add("User-Agent", "GCPing-CLI")
+	client := p.client
+	if p.h3 != nil && p.opts.Mode == Cold {
+		// QUIC connections are always reused, so use a new transport.
+		t := newH3Transport(p.opts.Family)
+		t.TLSClientConfig = p.h3.TLSClientConfig
+		defer t.Close()
+		client = &http.Client{Transport: t, Timeout: p.opts.Timeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer res.Body.Close()
+	// Read the whole body so the connection can be reused.
+	var b strings.Builder
+	n, err := io.Copy(&limitedWriter{w: &b, n: 128}, res.Body)
+	if err != nil {
+		return res, b.String(), n, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return res, b.String(), 0, &StatusError{Code: res.StatusCode}
+	}
+
+	switch {
+	case p.opts.Download > 0:
+		if n != p.opts.Download {
+			return res, b.String(), n, fmt.Errorf("downloaded %d of %d bytes", n, p.opts.Download)
+		}
+		return res, b.String(), n, nil
+	case p.opts.Upload > 0:
+		// The server responds with the number of bytes it received.
+		got, err := strconv.ParseInt(strings.TrimSpace(b.String()), 10, 64)
+		if err != nil || got != p.opts.Upload {
+			return res, b.String(), 0, fmt.Errorf("uploaded %d bytes, server received %q", p.opts.Upload, b.String())
+		}
+		return res, b.String(), got, nil
+	}
+	return res, b.String(), 0, nil
+}
+
+// limitedWriter writes at most n bytes to w and discards the rest.
+type limitedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.n > 0 {
+		q := p
+		if len(q) > l.n {
+			q = q[:l.n]
+		}
+		l.n -= len(q)
+		l.w.Write(q)
+	}
+	return len(p), nil
+}
+
+// zeros is an io.Reader of an infinite stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// Run pings every endpoint in em Number times, with at most Concurrency
+// requests in flight, and calls fn with each result as it completes. em is
+// keyed by region. fn is never called concurrently. Run returns when all
+// requests have completed or ctx is done, in which case the error of ctx is
+// returned.
+//
+// In Warm mode, connections to every endpoint are opened before measuring,
+// one for each request that may be in flight to it.
+func (p *Prober) Run(ctx context.Context, em map[string]Endpoint, fn func(Result)) error {
+	if p.opts.Mode == Warm {
+		if p.opts.Proto == HTTP {
+			p.warm(ctx, em, min(p.opts.Concurrency, p.opts.Number))
+		} else if err := p.run(ctx, em, 1, nil, func(Result) {}); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return p.run(ctx, em, p.opts.Number, p.opts.BeforePing, fn)
+}
+
+// warm opens n HTTP connections to each endpoint in em, with at most
+// Concurrency requests in flight. The requests that open them hold on to
+// their connection until all n are open, as a connection that is released
+// early would be reused instead.
+func (p *Prober) warm(ctx context.Context, em map[string]Endpoint, n int) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, p.opts.Concurrency)
+	for _, e := range em {
+		// Take the n slots of an endpoint at once, so that endpoints
+		// can't hold some each and wait for the rest.
+		for range n {
+			sem <- struct{}{}
+		}
+		var opened sync.WaitGroup
+		opened.Add(n)
+		for range n {
+			wg.Go(func() {
+				defer func() { <-sem }()
+				res, err := p.warmRequest(ctx, e)
+				opened.Done()
+				if err != nil {
+					return
+				}
+				opened.Wait()
+				// Read the whole body so the connection can be reused.
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+			})
+		}
+	}
+	wg.Wait()
+}
+
+// warmRequest sends a ping to e and returns the response with its body
+// unread.
+func (p *Prober) warmRequest(ctx context.Context, e Endpoint) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL+"/api/ping", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("User-Agent", "GCPing-CLI")
+	return p.client.Do(req)
+}
+
+// run pings every endpoint in em n times, calling before, if not nil,
+// before each ping.
+func (p *Prober) run(ctx context.Context, em map[string]Endpoint, n int, before func(Endpoint), fn func(Result)) error {
+	inputs := make(chan Endpoint)
+	results := make(chan Result)
+
+	go func() {
+		defer close(inputs)
+		for i := 0; i < n; i++ {
+			for r, e := range em {
+				e.Region = r
+				select {
+				case inputs <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range inputs {
+				if before != nil {
+					before(e)
+				}
+				results <- p.Ping(ctx, e)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for r := range results {
+		fn(r)
+	}
+	return ctx.Err()
+}
+
+// Collect is like Run, but also aggregates the results by region. The
+// summaries are sorted by median latency, fastest first. fn may be nil.
+func (p *Prober) Collect(ctx context.Context, em map[string]Endpoint, fn func(Result)) ([]*Summary, error) {
+	m := make(map[string]*Summary)
+	err := p.Run(ctx, em, func(r Result) {
+		s, ok := m[r.Region]
+		if !ok {
+			s = &Summary{
+				Region:            r.Region,
+				Endpoint:          r.Endpoint,
+				IncludeColdStarts: p.opts.IncludeColdStarts,
+			}
+			m[r.Region] = s
+		}
+		s.Add(r)
+		if fn != nil {
+			fn(r)
+		}
+	})
+
+	all := make([]*Summary, 0, len(m))
+	for _, s := range m {
+		all = append(all, s)
+	}
+	Sort(all)
+	return all, err
+}
+
+// Sort sorts summaries by median latency, fastest first. Summaries without
+// any durations, e.g. because all requests were cold starts, and summaries
+// where every request failed sort last.
+func Sort(summaries []*Summary) {
+	medians := make(map[*Summary]time.Duration, len(summaries))
+	for _, s := range summaries {
+		medians[s] = s.Median()
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Failed() || b.Failed() {
+			return b.Failed() && !a.Failed()
+		}
+		return medians[a] < medians[b]
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/httphandler"
+)
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	ok := httptest.NewServer(httphandler.New(&httphandler.Options{Region: "ok-region"}))
+	t.Cleanup(ok.Close)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	em := map[string]Endpoint{
+		"ok-region":      {URL: ok.URL, RegionName: "OK"},
+		"failing-region": {URL: failing.URL, RegionName: "Failing"},
+	}
+	p := New(&Options{Number: 3, Concurrency: 2})
+
+	var results int
+	summaries, err := p.Collect(context.Background(), em, func(r Result) {
+		results++
+		if r.Region == "" {
+			t.Errorf("Result.Region is empty for %v", r.Endpoint.URL)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+	if got, want := results, 6; got != want {
+		t.Errorf("Collect() called fn %d times, want %d", got, want)
+	}
+	if got, want := len(summaries), 2; got != want {
+		t.Fatalf("Collect() returned %d summaries, want %d", got, want)
+	}
+	for _, s := range summaries {
+		// The first request served by httphandler is a cold start and is
+		// excluded from durations.
+		wantDurations, wantErrors, wantColdStarts := 2, 0, 1
+		if s.Region == "failing-region" {
+			wantDurations, wantErrors, wantColdStarts = 3, 3, 0
+		}
+		if got := len(s.Durations); got != wantDurations {
+			t.Errorf("%s: got %d durations, want %d", s.Region, got, wantDurations)
+		}
+		if got := s.Errors; got != wantErrors {
+			t.Errorf("%s: got %d errors, want %d", s.Region, got, wantErrors)
+		}
+		if got := s.ColdStarts; got != wantColdStarts {
+			t.Errorf("%s: got %d cold starts, want %d", s.Region, got, wantColdStarts)
+		}
+		// httphandler reports its time in Server-Timing.
+		if p := s.PhaseMedian(); s.Region == "ok-region" && (p.Server <= 0 || p.Network <= 0) {
+			t.Errorf("%s: got server time %v and network time %v, want positive", s.Region, p.Server, p.Network)
+		}
+		if got, want := s.Endpoint.RegionName, em[s.Region].RegionName; got != want {
+			t.Errorf("%s: got RegionName %q, want %q", s.Region, got, want)
+		}
+	}
+	// Regions where every request failed sort last.
+	if got, want := summaries[1].Region, "failing-region"; got != want {
+		t.Errorf("Collect() sorted %q last, want %q", got, want)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(httphandler.New(&httphandler.Options{Region: "test-region"}))
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := New(&Options{Number: 100})
+	var results int
+	err := p.Run(ctx, map[string]Endpoint{"test-region": {URL: ts.URL}}, func(r Result) {
+		results++
+	})
+	if err != context.Canceled {
+		t.Errorf("Run() = %v, want %v", err, context.Canceled)
+	}
+	if results >= 100 {
+		t.Errorf("Run() completed %d requests after cancellation", results)
+	}
+}
+
+func TestModes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		mode        Mode
+		wantConnect bool
+	}{
+		{"cold", Cold, true},
+		{"warm", Warm, false},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ts := httptest.NewServer(httphandler.New(&httphandler.Options{Region: "test-region"}))
+			t.Cleanup(ts.Close)
+
+			p := New(&Options{Number: 3, Concurrency: 1, Mode: tc.mode})
+			err := p.Run(context.Background(), map[string]Endpoint{"test-region": {URL: ts.URL}}, func(r Result) {
+				if r.Err != nil {
+					t.Errorf("Run() result error: %v", r.Err)
+				}
+				if got := r.Phases.Connect > 0; got != tc.wantConnect {
+					t.Errorf("Run() connected = %v, want %v", got, tc.wantConnect)
+				}
+			})
+			if err != nil {
+				t.Fatalf("Run() failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestWarmConcurrent(t *testing.T) {
+	t.Parallel()
+
+	// More endpoints than the default idle pool of the transport can
+	// keep warm.
+	for _, endpoints := range []int{1, 15} {
+		var mu sync.Mutex
+		var inFlight, maxInFlight int
+		// Slow responses keep concurrent requests in flight together.
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			w.Write([]byte("pong"))
+		})
+		em := make(map[string]Endpoint, endpoints)
+		for i := range endpoints {
+			ts := httptest.NewServer(handler)
+			t.Cleanup(ts.Close)
+			em[fmt.Sprintf("region-%d", i)] = Endpoint{URL: ts.URL}
+		}
+
+		p := New(&Options{Number: 10, Concurrency: 10, Mode: Warm})
+		var connected, results int
+		err := p.Run(context.Background(), em, func(r Result) {
+			results++
+			if r.Err != nil {
+				t.Errorf("%d endpoints: Run() result error: %v", endpoints, r.Err)
+			}
+			if r.Phases.Connect > 0 {
+				connected++
+			}
+		})
+		p.Close()
+		if err != nil {
+			t.Fatalf("%d endpoints: Run() failed: %v", endpoints, err)
+		}
+		if connected > 0 {
+			t.Errorf("%d endpoints: %d of %d warm requests opened a connection, want 0", endpoints, connected, results)
+		}
+		if maxInFlight > 10 {
+			t.Errorf("%d endpoints: %d requests in flight, want at most 10", endpoints, maxInFlight)
+		}
+	}
+}
+
+func TestBeforePing(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(pingHandler())
+	t.Cleanup(ts.Close)
+	em := map[string]Endpoint{"test-region": {URL: ts.URL}}
+
+	for _, mode := range []Mode{Reuse, Warm} {
+		var mu sync.Mutex
+		var pings []string
+		p := New(&Options{Number: 3, Concurrency: 2, Mode: mode, BeforePing: func(e Endpoint) {
+			mu.Lock()
+			defer mu.Unlock()
+			pings = append(pings, e.Region)
+		}})
+		if err := p.Run(context.Background(), em, func(Result) {}); err != nil {
+			t.Fatalf("Mode %v: Run() failed: %v", mode, err)
+		}
+		// Warm-up requests are not measured, so they are not reported.
+		if want := []string{"test-region", "test-region", "test-region"}; !slices.Equal(pings, want) {
+			t.Errorf("Mode %v: BeforePing() called with %q, want %q", mode, pings, want)
+		}
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(httphandler.New(&httphandler.Options{Region: "test-region", Throughput: true}))
+	t.Cleanup(ts.Close)
+	em := map[string]Endpoint{"test-region": {URL: ts.URL}}
+
+	testCases := []struct {
+		name string
+		opts Options
+	}{
+		{"download", Options{Number: 2, Download: 1 << 20}},
+		{"upload", Options{Number: 2, Upload: 1 << 20}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			summaries, err := New(&tc.opts).Collect(context.Background(), em, func(r Result) {
+				if r.Err != nil {
+					t.Errorf("Collect() result error: %v", r.Err)
+				}
+				if got, want := r.Bytes, int64(1<<20); got != want {
+					t.Errorf("Collect() result bytes = %d, want %d", got, want)
+				}
+			})
+			if err != nil {
+				t.Fatalf("Collect() failed: %v", err)
+			}
+			if got := summaries[0].Throughput(); got <= 0 {
+				t.Errorf("Throughput() = %v, want > 0", got)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	t.Parallel()
+
+	summaries := []*Summary{
+		{Region: "dead", Durations: []time.Duration{time.Millisecond}, Errors: 1},
+		{Region: "slow", Durations: []time.Duration{50 * time.Millisecond}},
+		{Region: "empty"},
+		{Region: "fast", Durations: []time.Duration{10 * time.Millisecond, time.Millisecond}, Errors: 1},
+	}
+	Sort(summaries)
+	var got []string
+	for _, s := range summaries {
+		got = append(got, s.Region)
+	}
+	if want := []string{"fast", "slow", "dead", "empty"}; !slices.Equal(got, want) {
+		t.Errorf("Sort() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Summary aggregates the results of a region.
+type Summary struct {
+	// Region is the region of the endpoint, e.g., us-central1.
+	Region string
+	// Endpoint is the endpoint that was pinged.
+	Endpoint Endpoint
+	// Durations are the latencies of all requests in completion order.
+	Durations []time.Duration
+	// Phases are the phases of all requests, in the same order as
+	// Durations.
+	Phases []Phases
+	// Bytes are the payload sizes of all requests, in the same order as
+	// Durations. They are zero unless measuring throughput.
+	Bytes []int64
+	// Exchanges are the timestamp exchanges of successful requests in
+	// Clock mode.
+	Exchanges []Exchange
+	// Protocols counts the successful HTTP requests by negotiated
+	// protocol.
+	Protocols map[string]int
+	// Addrs are the distinct IP addresses pinged, in the order first seen.
+	Addrs []string
+	// Errors is the number of failed requests.
+	Errors int
+	// ColdStarts is the number of requests that were the first served by
+	// an instance.
+	ColdStarts int
+	// Lost is the number of UDP packets whose echo didn't arrive. They are
+	// counted in Errors, but not in Durations.
+	Lost int
+	// Reordered is the number of UDP echoes that arrived after the echo of
+	// a later packet.
+	Reordered int
+	// IncludeColdStarts adds cold starts to Durations and Phases. By
+	// default, they are only counted in ColdStarts.
+	IncludeColdStarts bool
+}
+
+// Add adds r to the summary.
+func (s *Summary) Add(r Result) {
+	if r.Addr != "" && !slices.Contains(s.Addrs, r.Addr) {
+		s.Addrs = append(s.Addrs, r.Addr)
+	}
+	if errors.Is(r.Err, ErrPacketLost) {
+		s.Errors++
+		s.Lost++
+		return
+	}
+	if r.Reordered {
+		s.Reordered++
+	}
+	if r.ColdStart {
+		s.ColdStarts++
+		if !s.IncludeColdStarts {
+			return
+		}
+	}
+	s.Durations = append(s.Durations, r.Duration)
+	s.Phases = append(s.Phases, r.Phases)
+	s.Bytes = append(s.Bytes, r.Bytes)
+	if r.Err != nil {
+		s.Errors++
+		return
+	}
+	if !r.Exchange.ServerReceived.IsZero() {
+		s.Exchanges = append(s.Exchanges, r.Exchange)
+	}
+	if r.Protocol != "" {
+		if s.Protocols == nil {
+			s.Protocols = make(map[string]int)
+		}
+		s.Protocols[r.Protocol]++
+	}
+}
+
+// Protocol returns the protocol negotiated by most successful HTTP
+// requests, or "" if there are none.
+func (s *Summary) Protocol() string {
+	var protocol string
+	for p, n := range s.Protocols {
+		if n > s.Protocols[protocol] || n == s.Protocols[protocol] && p < protocol {
+			protocol = p
+		}
+	}
+	return protocol
+}
+
+// ErrorRate returns the fraction of requests that failed.
+func (s *Summary) ErrorRate() float64 {
+	n := len(s.Durations) + s.Lost
+	if !s.IncludeColdStarts {
+		n += s.ColdStarts
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(n)
+}
+
+// Failed reports whether s has no successful request, either because every
+// request failed or because none was counted.
+func (s *Summary) Failed() bool {
+	return len(s.Durations) == 0 || s.ErrorRate() == 1
+}
+
+// LossRate returns the fraction of UDP packets that were lost.
+func (s *Summary) LossRate() float64 {
+	n := len(s.Durations) + s.Lost
+	if n == 0 {
+		return 0
+	}
+	return float64(s.Lost) / float64(n)
+}
+
+// Median returns the median of Durations.
+func (s *Summary) Median() time.Duration {
+	return s.Stats().P50
+}
+
+// OneWay estimates the clock offset and one-way delays from Exchanges.
+func (s *Summary) OneWay() OneWay {
+	return EstimateOneWay(s.Exchanges)
+}
+
+// Stats returns the summary statistics of Durations.
+func (s *Summary) Stats() Stats {
+	return NewStats(s.Durations)
+}
+
+// Throughput returns the median throughput of requests that transferred a
+// payload, in bits per second. The whole request duration is used, so
+// latency lowers the throughput of small payloads.
+func (s *Summary) Throughput() float64 {
+	var bps []float64
+	for i, n := range s.Bytes {
+		if n > 0 && s.Durations[i] > 0 {
+			bps = append(bps, float64(n*8)/s.Durations[i].Seconds())
+		}
+	}
+	if len(bps) == 0 {
+		return 0
+	}
+	sort.Float64s(bps)
+	return bps[len(bps)/2]
+}
+
+// PhaseMedian returns the median of each phase across the requests that
+// went through it. With reused connections, DNS lookup, connect and TLS
+// handshake only happen in a few requests, so their medians are over those
+// requests. A phase that never happened is zero.
+func (s *Summary) PhaseMedian() Phases {
+	pick := func(f func(p Phases) time.Duration) time.Duration {
+		var d []time.Duration
+		for _, p := range s.Phases {
+			if v := f(p); v > 0 {
+				d = append(d, v)
+			}
+		}
+		if len(d) == 0 {
+			return 0
+		}
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		return d[len(d)/2]
+	}
+	return Phases{
+		DNS:     pick(func(p Phases) time.Duration { return p.DNS }),
+		Connect: pick(func(p Phases) time.Duration { return p.Connect }),
+		TLS:     pick(func(p Phases) time.Duration { return p.TLS }),
+		TTFB:    pick(func(p Phases) time.Duration { return p.TTFB }),
+		Server:  pick(func(p Phases) time.Duration { return p.Server }),
+		Network: pick(func(p Phases) time.Duration { return p.Network }),
+	}
+}
+
+// Stats summarizes a set of latency samples.
+type Stats struct {
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	StdDev time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	// Jitter is the mean absolute difference between consecutive samples.
+	Jitter time.Duration
+}
+
+// NewStats computes Stats over d. The order of d is significant for Jitter
+// and d is not modified. Percentiles pick the sample at index n*p/100 of
+// the sorted samples, so P50 is the upper median.
+func NewStats(d []time.Duration) Stats {
+	if len(d) == 0 {
+		return Stats{}
+	}
+
+	sorted := make([]time.Duration, len(d))
+	copy(sorted, d)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var sum float64
+	for _, v := range d {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(d))
+
+	var sq float64
+	for _, v := range d {
+		sq += (float64(v) - mean) * (float64(v) - mean)
+	}
+
+	var jitter time.Duration
+	if len(d) > 1 {
+		var diff time.Duration
+		for i := 1; i < len(d); i++ {
+			delta := d[i] - d[i-1]
+			if delta < 0 {
+				delta = -delta
+			}
+			diff += delta
+		}
+		jitter = diff / time.Duration(len(d)-1)
+	}
+
+	return Stats{
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Mean:   time.Duration(mean),
+		StdDev: time.Duration(math.Sqrt(sq / float64(len(d)))),
+		P50:    percentile(sorted, 50),
+		P90:    percentile(sorted, 90),
+		P95:    percentile(sorted, 95),
+		P99:    percentile(sorted, 99),
+		Jitter: jitter,
+	}
+}
+
+// percentile returns the p-th percentile of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted)) * p / 100)
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
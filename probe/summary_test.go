@@ -0,0 +1,112 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewStats(t *testing.T) {
+	const ms = time.Millisecond
+	testCases := []struct {
+		name string
+		in   []time.Duration
+		want Stats
+	}{
+		{
+			name: "empty",
+			want: Stats{},
+		},
+		{
+			name: "single",
+			in:   []time.Duration{5 * ms},
+			want: Stats{Min: 5 * ms, Max: 5 * ms, Mean: 5 * ms, P50: 5 * ms, P90: 5 * ms, P95: 5 * ms, P99: 5 * ms},
+		},
+		{
+			name: "unsorted",
+			in:   []time.Duration{4 * ms, 2 * ms, 8 * ms, 6 * ms},
+			want: Stats{
+				Min:    2 * ms,
+				Max:    8 * ms,
+				Mean:   5 * ms,
+				StdDev: 2236067, // sqrt(5)ms
+				P50:    6 * ms,
+				P90:    8 * ms,
+				P95:    8 * ms,
+				P99:    8 * ms,
+				Jitter: 3333333, // (2+6+2)/3 ms
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			in := append([]time.Duration(nil), tc.in...)
+			got := NewStats(in)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("NewStats() = (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.in, in); diff != "" {
+				t.Errorf("NewStats() modified its input (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSummaryAddColdStart(t *testing.T) {
+	t.Parallel()
+
+	for _, include := range []bool{false, true} {
+		s := &Summary{IncludeColdStarts: include}
+		s.Add(Result{Duration: 3 * time.Second, ColdStart: true})
+		s.Add(Result{Duration: time.Millisecond})
+
+		if got, want := s.ColdStarts, 1; got != want {
+			t.Errorf("IncludeColdStarts=%v: ColdStarts = %d, want %d", include, got, want)
+		}
+		wantDurations := 1
+		if include {
+			wantDurations = 2
+		}
+		if got := len(s.Durations); got != wantDurations {
+			t.Errorf("IncludeColdStarts=%v: got %d durations, want %d", include, got, wantDurations)
+		}
+	}
+}
+
+func TestPhaseMedian(t *testing.T) {
+	t.Parallel()
+
+	const ms = time.Millisecond
+	s := &Summary{}
+	// Only the first request opens a connection, as when connections are
+	// reused.
+	s.Add(Result{Phases: Phases{DNS: 5 * ms, Connect: 10 * ms, TLS: 20 * ms, TTFB: 30 * ms}})
+	for range 4 {
+		s.Add(Result{Phases: Phases{TTFB: 30 * ms}})
+	}
+	want := Phases{DNS: 5 * ms, Connect: 10 * ms, TLS: 20 * ms, TTFB: 30 * ms}
+	if diff := cmp.Diff(want, s.PhaseMedian()); diff != "" {
+		t.Errorf("PhaseMedian() mismatch (-want +got):\n%s", diff)
+	}
+	if got := (&Summary{}).PhaseMedian(); got != (Phases{}) {
+		t.Errorf("PhaseMedian() of empty summary = %+v, want zero", got)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+)
+
+// hostPort returns the host and port of e's URL, with the default port of
+// its scheme if the URL has none.
+func hostPort(e Endpoint) (host, port string, err error) {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return "", "", err
+	}
+	port = u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return u.Hostname(), port, nil
+}
+
+// pingTCP measures the time to open a TCP connection to e, which it closes
+// right away. The DNS lookup is not part of the measurement; it is
+// reported in Phases. Addresses are tried in the order returned by the
+// resolver, restricted to Family, and only the successful attempt is
+// measured.
+func (p *Prober) pingTCP(ctx context.Context, e Endpoint) Result {
+	r := Result{Region: e.Region, Endpoint: e}
+	host, port, err := hostPort(e)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if p.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	ips, err := net.DefaultResolver.LookupIP(ctx, p.opts.Family.network("ip"), host)
+	r.Phases.DNS = time.Since(start)
+	if err != nil {
+		r.Duration = r.Phases.DNS
+		r.Err = err
+		return r
+	}
+
+	var d net.Dialer
+	for _, ip := range ips {
+		start := time.Now()
+		var c net.Conn
+		c, err = d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+		r.Duration = time.Since(start)
+		r.Addr = ip.String()
+		if err == nil {
+			c.Close()
+			break
+		}
+	}
+	r.Phases.Connect = r.Duration
+	r.Err = err
+	return r
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestHostPort(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		url, wantHost, wantPort string
+	}{
+		{"https://us-central1-5tkroniexa-uc.a.run.app", "us-central1-5tkroniexa-uc.a.run.app", "443"},
+		{"http://localhost", "localhost", "80"},
+		{"http://127.0.0.1:8080", "127.0.0.1", "8080"},
+		{"https://[::1]:8443", "::1", "8443"},
+	}
+	for _, tc := range testCases {
+		host, port, err := hostPort(Endpoint{URL: tc.url})
+		if err != nil {
+			t.Errorf("hostPort(%q) failed: %v", tc.url, err)
+			continue
+		}
+		if host != tc.wantHost || port != tc.wantPort {
+			t.Errorf("hostPort(%q) = %q, %q, want %q, %q", tc.url, host, port, tc.wantHost, tc.wantPort)
+		}
+	}
+}
+
+func TestTCP(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	// Find a local port that nothing listens on.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	em := map[string]Endpoint{
+		"open-region":   {URL: "http://" + l.Addr().String()},
+		"closed-region": {URL: "http://" + closed.Addr().String()},
+	}
+	p := New(&Options{Number: 3, Proto: TCP})
+	summaries, err := p.Collect(context.Background(), em, nil)
+	if err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+	for _, s := range summaries {
+		wantErrors := 0
+		if s.Region == "closed-region" {
+			wantErrors = 3
+		}
+		if got := s.Errors; got != wantErrors {
+			t.Errorf("%s: got %d errors, want %d", s.Region, got, wantErrors)
+		}
+		if wantErrors == 0 && (s.Median() <= 0 || s.PhaseMedian().Connect != s.Median()) {
+			t.Errorf("%s: got median %v and connect %v, want equal and positive", s.Region, s.Median(), s.PhaseMedian().Connect)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases is the time spent in each stage of a single request. Stages that
+// did not happen, e.g. DNS lookup and connect on a reused connection, are
+// zero.
+type Phases struct {
+	// DNS is the time spent resolving the endpoint host.
+	DNS time.Duration
+	// Connect is the time spent in the TCP handshake.
+	Connect time.Duration
+	// TLS is the time spent in the TLS handshake.
+	TLS time.Duration
+	// TTFB is the time from the request being written to the first
+	// response byte.
+	TTFB time.Duration
+	// Server is the time the server spent handling the request, as
+	// reported by its Server-Timing header.
+	Server time.Duration
+	// Network is the total latency minus Server, i.e. the time spent on
+	// the network. It is zero if the server did not report its time.
+	Network time.Duration
+}
+
+// tracer collects phase timings through httptrace hooks. Hooks may be
+// called from multiple goroutines when dialing races address families.
+type tracer struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+	addr                      string // remote IP of the connection used
+}
+
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	set := func(dst *time.Time) {
+		now := time.Now()
+		t.mu.Lock()
+		*dst = now
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			// Keep the earliest attempt when several addresses are dialed.
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, addr string, err error) {
+			if err == nil {
+				set(&t.connectDone)
+				t.mu.Lock()
+				t.addr = ipOf(addr)
+				t.mu.Unlock()
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.addr = ipOf(info.Conn.RemoteAddr().String())
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart:    func() { set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { set(&t.firstByte) },
+	}
+}
+
+func (t *tracer) phases() Phases {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Phases{
+		DNS:     between(t.dnsStart, t.dnsDone),
+		Connect: between(t.connectStart, t.connectDone),
+		TLS:     between(t.tlsStart, t.tlsDone),
+		TTFB:    between(t.wroteRequest, t.firstByte),
+	}
+}
+
+// requestTimes returns when the request was written and when the first
+// response byte arrived.
+func (t *tracer) requestTimes() (wrote, firstByte time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.wroteRequest, t.firstByte
+}
+
+// remoteAddr returns the IP address the request was sent to, or "" if no
+// connection was made.
+func (t *tracer) remoteAddr() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.addr
+}
+
+// ipOf returns the host of addr without its port.
+func ipOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// between returns end-start, or zero if either time was not recorded.
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// serverTime returns the duration of the "app" metric of the Server-Timing
+// header in h, or zero if it is missing.
+func serverTime(h http.Header) time.Duration {
+	for _, v := range h.Values("Server-Timing") {
+		for _, metric := range strings.Split(v, ",") {
+			params := strings.Split(metric, ";")
+			if strings.TrimSpace(params[0]) != "app" {
+				continue
+			}
+			for _, p := range params[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if k != "dur" {
+					continue
+				}
+				ms, err := strconv.ParseFloat(v, 64)
+				if err != nil || ms < 0 {
+					return 0
+				}
+				return time.Duration(ms * float64(time.Millisecond))
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServerTime(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		header []string
+		want   time.Duration
+	}{
+		{nil, 0},
+		{[]string{`app;dur=1.5, recv;desc="1700000000000000000"`}, 1500 * time.Microsecond},
+		{[]string{`db;dur=3`, `app; desc="handler"; dur=0.012`}, 12 * time.Microsecond},
+		{[]string{`total;dur=2`}, 0},
+		{[]string{`app;dur=invalid`}, 0},
+		{[]string{`app`}, 0},
+	}
+	for _, tc := range testCases {
+		h := http.Header{"Server-Timing": tc.header}
+		if got := serverTime(h); got != tc.want {
+			t.Errorf("serverTime(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
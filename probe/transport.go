@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newTransport returns an HTTP/1.1 or HTTP/2 transport configured for the
+// Mode, HTTPVersion and Family of opts.
+func newTransport(opts Options) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	switch opts.Mode {
+	case Cold:
+		t.DisableKeepAlives = true
+	case Warm:
+		// Keep a warm connection for each request that may be in flight
+		// to the same endpoint, for all endpoints.
+		t.MaxIdleConnsPerHost = opts.Concurrency
+		t.MaxIdleConns = 0
+	}
+	if opts.Family != AnyFamily {
+		// Dial like the default transport, on the network of the family.
+		d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, opts.Family.network(network), addr)
+		}
+	}
+	switch opts.HTTPVersion {
+	case HTTP1:
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetHTTP1(true)
+		// Once used, the default transport offers h2 in TLS handshakes.
+		if t.TLSClientConfig != nil {
+			t.TLSClientConfig.NextProtos = nil
+		}
+	case HTTP2:
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetHTTP2(true)
+		t.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return t
+}
+
+// network returns network, e.g. "tcp", restricted to family f.
+func (f Family) network(network string) string {
+	switch f {
+	case IPv4:
+		return network + "4"
+	case IPv6:
+		return network + "6"
+	}
+	return network
+}
+
+// newH3Transport returns an HTTP/3 transport that connects to addresses of
+// family f.
+func newH3Transport(f Family) *http3.Transport {
+	t := &http3.Transport{}
+	if f == AnyFamily {
+		return t
+	}
+	t.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		// Report the lookup and handshake like the default dialer does.
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace == nil {
+			trace = &httptrace.ClientTrace{}
+		}
+		if trace.DNSStart != nil {
+			trace.DNSStart(httptrace.DNSStartInfo{Host: addr})
+		}
+		udpAddr, err := net.ResolveUDPAddr(f.network("udp"), addr)
+		if trace.DNSDone != nil {
+			trace.DNSDone(httptrace.DNSDoneInfo{Err: err})
+		}
+		if err != nil {
+			return nil, err
+		}
+		if trace.ConnectStart != nil {
+			trace.ConnectStart("udp", udpAddr.String())
+		}
+		if trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		conn, err := quic.DialAddrEarly(ctx, udpAddr.String(), tlsCfg, cfg)
+		if trace.TLSHandshakeDone != nil {
+			var state tls.ConnectionState
+			if conn != nil {
+				state = conn.ConnectionState().TLS
+			}
+			trace.TLSHandshakeDone(state, err)
+		}
+		if trace.ConnectDone != nil {
+			trace.ConnectDone("udp", udpAddr.String(), err)
+		}
+		return conn, err
+	}
+	return t
+}
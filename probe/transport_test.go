@@ -0,0 +1,182 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func pingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+}
+
+func TestHTTPVersion(t *testing.T) {
+	t.Parallel()
+
+	// Serve HTTP/1.1 and h2c without TLS, and HTTP/1.1 and HTTP/2 over TLS.
+	plain := httptest.NewUnstartedServer(pingHandler())
+	plain.Config.Protocols = new(http.Protocols)
+	plain.Config.Protocols.SetHTTP1(true)
+	plain.Config.Protocols.SetUnencryptedHTTP2(true)
+	plain.Start()
+	t.Cleanup(plain.Close)
+	secure := httptest.NewUnstartedServer(pingHandler())
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	t.Cleanup(secure.Close)
+
+	testCases := []struct {
+		version HTTPVersion
+		url     string
+		want    string
+	}{
+		{HTTPAuto, plain.URL, "HTTP/1.1"},
+		{HTTP1, plain.URL, "HTTP/1.1"},
+		{HTTP2, plain.URL, "HTTP/2.0"},
+		{HTTPAuto, secure.URL, "HTTP/2.0"},
+		{HTTP1, secure.URL, "HTTP/1.1"},
+		{HTTP2, secure.URL, "HTTP/2.0"},
+	}
+	// Trust the certificate of the TLS server.
+	roots := secure.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	for _, tc := range testCases {
+		p := New(&Options{HTTPVersion: tc.version, Mode: Cold})
+		p.client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: roots}
+		r := p.Ping(context.Background(), Endpoint{URL: tc.url})
+		if r.Err != nil {
+			t.Errorf("HTTPVersion %v, %s: Ping() failed: %v", tc.version, tc.url, r.Err)
+			continue
+		}
+		if r.Protocol != tc.want {
+			t.Errorf("HTTPVersion %v, %s: got protocol %q, want %q", tc.version, tc.url, r.Protocol, tc.want)
+		}
+	}
+}
+
+func TestHTTP3(t *testing.T) {
+	t.Parallel()
+
+	// Reuse the certificate of a TLS test server, which the client of the
+	// test server trusts.
+	ts := httptest.NewTLSServer(pingHandler())
+	t.Cleanup(ts.Close)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http3.Server{
+		Handler:   pingHandler(),
+		TLSConfig: http3.ConfigureTLSConfig(ts.TLS.Clone()),
+	}
+	go srv.Serve(pc)
+	t.Cleanup(func() { srv.Close() })
+
+	em := map[string]Endpoint{"local": {URL: "https://" + pc.LocalAddr().String()}}
+	for _, mode := range []Mode{Reuse, Cold} {
+		p := New(&Options{Number: 3, HTTPVersion: HTTP3, Mode: mode})
+		p.h3.TLSClientConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+		summaries, err := p.Collect(context.Background(), em, nil)
+		p.Close()
+		if err != nil {
+			t.Fatalf("Mode %v: Collect() failed: %v", mode, err)
+		}
+		s := summaries[0]
+		if s.Errors != 0 || s.Protocols["HTTP/3.0"] != 3 {
+			t.Errorf("Mode %v: got %d errors and protocols %v, want 3 HTTP/3.0", mode, s.Errors, s.Protocols)
+		}
+	}
+}
+
+func TestSummaryProtocol(t *testing.T) {
+	t.Parallel()
+
+	var s Summary
+	if got := s.Protocol(); got != "" {
+		t.Errorf("Protocol() = %q, want empty", got)
+	}
+	s.Add(Result{Protocol: "HTTP/1.1"})
+	s.Add(Result{Protocol: "HTTP/2.0"})
+	s.Add(Result{Protocol: "HTTP/2.0"})
+	s.Add(Result{Protocol: "HTTP/1.1", Err: &StatusError{Code: 500}})
+	if got, want := s.Protocol(), "HTTP/2.0"; got != want {
+		t.Errorf("Protocol() = %q, want %q", got, want)
+	}
+}
+
+func TestFamily(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(pingHandler())
+	t.Cleanup(ts.Close)
+	em := map[string]Endpoint{"local": {URL: ts.URL}}
+
+	testCases := []struct {
+		proto    Proto
+		family   Family
+		wantErrs int
+		wantAddr string
+	}{
+		{HTTP, AnyFamily, 0, "127.0.0.1"},
+		{HTTP, IPv4, 0, "127.0.0.1"},
+		{HTTP, IPv6, 2, ""},
+		{TCP, IPv4, 0, "127.0.0.1"},
+		{TCP, IPv6, 2, ""},
+	}
+	for _, tc := range testCases {
+		p := New(&Options{Number: 2, Proto: tc.proto, Family: tc.family})
+		summaries, err := p.Collect(context.Background(), em, nil)
+		if err != nil {
+			t.Fatalf("Collect() failed: %v", err)
+		}
+		s := summaries[0]
+		var wantAddrs []string
+		if tc.wantAddr != "" {
+			wantAddrs = []string{tc.wantAddr}
+		}
+		if s.Errors != tc.wantErrs || !slices.Equal(s.Addrs, wantAddrs) {
+			t.Errorf("Proto %v, Family %v: got %d errors, addrs %q, want %d, %q", tc.proto, tc.family, s.Errors, s.Addrs, tc.wantErrs, wantAddrs)
+		}
+	}
+}
+
+func TestFamilyNetwork(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		family  Family
+		network string
+		want    string
+	}{
+		{AnyFamily, "tcp", "tcp"},
+		{IPv4, "tcp", "tcp4"},
+		{IPv6, "udp", "udp6"},
+		{IPv6, "ip", "ip6"},
+	}
+	for _, tc := range testCases {
+		if got := tc.family.network(tc.network); got != tc.want {
+			t.Errorf("Family(%v).network(%q) = %q, want %q", tc.family, tc.network, got, tc.want)
+		}
+	}
+}
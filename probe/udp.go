@@ -0,0 +1,166 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/udpecho"
+)
+
+// ErrPacketLost is the error of a UDP ping whose echo did not arrive
+// within the timeout.
+var ErrPacketLost = errors.New("packet lost")
+
+// defaultUDPTimeout is how long a UDP ping waits for its echo if Timeout
+// is not set.
+const defaultUDPTimeout = time.Second
+
+// udpReply is the echo of a UDP packet.
+type udpReply struct {
+	received  time.Time
+	reordered bool
+}
+
+// udpConn is a UDP socket to the echo server of an endpoint. Pings to the
+// endpoint share it, so that concurrent pings are sent in bursts. The socket
+// isn't connected, so ICMP errors are ignored and unanswered packets are
+// reported as lost.
+type udpConn struct {
+	c    net.PacketConn
+	addr net.Addr
+
+	mu      sync.Mutex
+	seq     uint64
+	maxSeq  uint64 // highest sequence number received
+	pending map[uint64]chan udpReply
+}
+
+// udpConn returns the socket to e, dialing it if needed.
+func (p *Prober) udpConn(e Endpoint) (*udpConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if u, ok := p.udpConns[e.URL]; ok {
+		return u, nil
+	}
+	host, _, err := hostPort(e)
+	if err != nil {
+		return nil, err
+	}
+	port := p.opts.UDPPort
+	if port == 0 {
+		port = udpecho.DefaultPort
+	}
+	addr, err := net.ResolveUDPAddr(p.opts.Family.network("udp"), net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	c, err := net.ListenPacket("udp", "")
+	if err != nil {
+		return nil, err
+	}
+	u := &udpConn{c: c, addr: addr, pending: make(map[uint64]chan udpReply)}
+	go u.read()
+	if p.udpConns == nil {
+		p.udpConns = make(map[string]*udpConn)
+	}
+	p.udpConns[e.URL] = u
+	return u, nil
+}
+
+// read delivers echoes to the pings waiting for them until the socket is
+// closed.
+func (u *udpConn) read() {
+	buf := make([]byte, udpecho.PacketSize+1)
+	for {
+		n, _, err := u.c.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		received := time.Now()
+		seq, ok := udpecho.Seq(buf[:n])
+		if !ok {
+			continue
+		}
+		u.mu.Lock()
+		ch, ok := u.pending[seq]
+		delete(u.pending, seq)
+		reordered := seq < u.maxSeq
+		if seq > u.maxSeq {
+			u.maxSeq = seq
+		}
+		u.mu.Unlock()
+		if ok {
+			ch <- udpReply{received: received, reordered: reordered}
+		}
+	}
+}
+
+// pingUDP sends a packet to the UDP echo server of e and measures the time
+// until it is echoed back. If the echo doesn't arrive within Timeout, or a
+// second by default, the result has ErrPacketLost.
+func (p *Prober) pingUDP(ctx context.Context, e Endpoint) Result {
+	r := Result{Region: e.Region, Endpoint: e}
+	u, err := p.udpConn(e)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Addr = ipOf(u.addr.String())
+
+	timeout := p.opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultUDPTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// Send packets in sequence order, so that reordering is only caused
+	// by the network.
+	ch := make(chan udpReply, 1)
+	u.mu.Lock()
+	u.seq++
+	seq := u.seq
+	u.pending[seq] = ch
+	start := time.Now()
+	_, err = u.c.WriteTo(udpecho.Packet(seq), u.addr)
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		delete(u.pending, seq)
+		u.mu.Unlock()
+	}()
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	select {
+	case reply := <-ch:
+		r.Duration = reply.received.Sub(start)
+		r.Reordered = reply.reordered
+	case <-timer.C:
+		r.Duration = timeout
+		r.Err = ErrPacketLost
+	case <-ctx.Done():
+		r.Duration = time.Since(start)
+		r.Err = ctx.Err()
+	}
+	return r
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/udpecho"
+)
+
+// udpServer runs serve on a local UDP socket and returns its port.
+func udpServer(t *testing.T, serve func(pc net.PacketConn)) int {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go serve(pc)
+	return pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+func collectUDP(t *testing.T, port, n int) *Summary {
+	t.Helper()
+	em := map[string]Endpoint{"local": {URL: "http://127.0.0.1"}}
+	p := New(&Options{Number: n, Concurrency: n, Proto: UDP, UDPPort: port, Timeout: 200 * time.Millisecond})
+	t.Cleanup(func() { p.Close() })
+	summaries, err := p.Collect(context.Background(), em, nil)
+	if err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+	return summaries[0]
+}
+
+func TestUDP(t *testing.T) {
+	t.Parallel()
+
+	port := udpServer(t, func(pc net.PacketConn) { udpecho.Serve(pc) })
+	s := collectUDP(t, port, 5)
+	if s.Errors != 0 || s.Lost != 0 || s.Reordered != 0 {
+		t.Errorf("got %d errors, %d lost, %d reordered, want none", s.Errors, s.Lost, s.Reordered)
+	}
+	if len(s.Durations) != 5 || s.Median() <= 0 {
+		t.Errorf("got durations %v, want 5 positive", s.Durations)
+	}
+}
+
+func TestUDPLoss(t *testing.T) {
+	t.Parallel()
+
+	// Echo only packets with even sequence numbers.
+	port := udpServer(t, func(pc net.PacketConn) {
+		buf := make([]byte, udpecho.PacketSize)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if seq, _ := udpecho.Seq(buf[:n]); seq%2 == 0 {
+				pc.WriteTo(buf[:n], addr)
+			}
+		}
+	})
+	s := collectUDP(t, port, 4)
+	if s.Lost != 2 || s.Errors != 2 || len(s.Durations) != 2 {
+		t.Errorf("got %d lost, %d errors, %d durations, want 2 each", s.Lost, s.Errors, len(s.Durations))
+	}
+	if got := s.LossRate(); got != 0.5 {
+		t.Errorf("LossRate() = %v, want 0.5", got)
+	}
+}
+
+func TestUDPReordered(t *testing.T) {
+	t.Parallel()
+
+	// Echo the packets of each pair in reverse order.
+	port := udpServer(t, func(pc net.PacketConn) {
+		var held []byte
+		for {
+			buf := make([]byte, udpecho.PacketSize)
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if held == nil {
+				held = buf[:n]
+				continue
+			}
+			pc.WriteTo(buf[:n], addr)
+			pc.WriteTo(held, addr)
+			held = nil
+		}
+	})
+	s := collectUDP(t, port, 2)
+	if s.Errors != 0 || s.Reordered != 1 {
+		t.Errorf("got %d errors, %d reordered, want 0, 1", s.Errors, s.Reordered)
+	}
+}
+
+func TestUDPLostError(t *testing.T) {
+	t.Parallel()
+
+	if got := ErrorClass(ErrPacketLost); got != ClassTimeout {
+		t.Errorf("ErrorClass(ErrPacketLost) = %q, want %q", got, ClassTimeout)
+	}
+	var s Summary
+	s.Add(Result{Duration: time.Second, Err: ErrPacketLost})
+	s.Add(Result{Duration: time.Millisecond})
+	if s.Lost != 1 || len(s.Durations) != 1 || s.ErrorRate() != 0.5 {
+		t.Errorf("got %d lost, %v durations, error rate %v, want 1, [1ms], 0.5", s.Lost, s.Durations, s.ErrorRate())
+	}
+}
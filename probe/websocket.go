@@ -0,0 +1,144 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// wsConn is a WebSocket connection to an endpoint. Pings to the endpoint
+// take turns, so that each message is timed on its own.
+type wsConn struct {
+	mu   sync.Mutex
+	c    *websocket.Conn // nil until dialed, or after an error
+	addr string          // remote IP of c
+	seq  uint64
+}
+
+// wsConn returns the connection to e, creating it if needed.
+func (p *Prober) wsConn(e Endpoint) *wsConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sockets == nil {
+		p.sockets = make(map[string]*wsConn)
+	}
+	c, ok := p.sockets[e.URL]
+	if !ok {
+		c = &wsConn{}
+		p.sockets[e.URL] = c
+	}
+	return c
+}
+
+// pingWS sends a message to e over its WebSocket connection and measures
+// the time until it is echoed back. The connection is dialed by the first
+// ping and is not part of the measurement.
+func (p *Prober) pingWS(ctx context.Context, e Endpoint) Result {
+	r := Result{Region: e.Region, Endpoint: e}
+	ws := p.wsConn(e)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.c == nil {
+		h := http.Header{"User-Agent": {"GCPing-CLI"}}
+		t := &tracer{}
+		start := time.Now()
+		c, res, err := websocket.Dial(httptrace.WithClientTrace(ctx, t.clientTrace()), e.URL+"/api/ws", &websocket.DialOptions{
+			HTTPClient: p.client,
+			HTTPHeader: h,
+		})
+		if err != nil {
+			if res != nil && res.StatusCode != http.StatusSwitchingProtocols {
+				err = &StatusError{Code: res.StatusCode}
+			}
+			r.Duration = time.Since(start)
+			r.Err = err
+			return r
+		}
+		ws.c = c
+		ws.addr = t.remoteAddr()
+	}
+	r.Addr = ws.addr
+
+	if p.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+	}
+	ws.seq++
+	msg := binary.BigEndian.AppendUint64(nil, ws.seq)
+
+	start := time.Now()
+	err := ws.c.Write(ctx, websocket.MessageBinary, msg)
+	var echo []byte
+	if err == nil {
+		_, echo, err = ws.c.Read(ctx)
+	}
+	r.Duration = time.Since(start)
+	if err == nil && !bytes.Equal(echo, msg) {
+		err = fmt.Errorf("sent message %x, got %x", msg, echo)
+	}
+	if err != nil {
+		// Redial on the next ping.
+		ws.c.CloseNow()
+		ws.c = nil
+		r.Err = err
+	}
+	return r
+}
+
+// Close closes the WebSocket, gRPC, UDP and HTTP/3 connections opened by
+// Ping.
+func (p *Prober) Close() error {
+	p.mu.Lock()
+	sockets, grpcConns, udpConns := p.sockets, p.grpcConns, p.udpConns
+	p.sockets, p.grpcConns, p.udpConns = nil, nil, nil
+	p.mu.Unlock()
+
+	for _, cc := range grpcConns {
+		cc.Close()
+	}
+	for _, u := range udpConns {
+		u.c.Close()
+	}
+	if p.h3 != nil {
+		p.h3.Close()
+	}
+
+	var wg sync.WaitGroup
+	for _, ws := range sockets {
+		wg.Add(1)
+		go func(ws *wsConn) {
+			defer wg.Done()
+			ws.mu.Lock()
+			defer ws.mu.Unlock()
+			if ws.c != nil {
+				ws.c.Close(websocket.StatusNormalClosure, "")
+				ws.c = nil
+			}
+		}(ws)
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/httphandler"
+)
+
+func TestWebSocket(t *testing.T) {
+	t.Parallel()
+
+	h := httphandler.New(&httphandler.Options{Region: "ok-region"})
+	var dials atomic.Int32
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dials.Add(1)
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ok.Close)
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(notFound.Close)
+
+	em := map[string]Endpoint{
+		"ok-region":        {URL: ok.URL},
+		"not-found-region": {URL: notFound.URL},
+	}
+	p := New(&Options{Number: 5, Concurrency: 4, Proto: WebSocket})
+	t.Cleanup(func() { p.Close() })
+	summaries, err := p.Collect(context.Background(), em, func(r Result) {
+		if r.Region == "ok-region" && r.Err != nil {
+			t.Errorf("Collect() result error: %v", r.Err)
+		}
+		if r.Region == "not-found-region" && ErrorClass(r.Err) != ClassHTTP {
+			t.Errorf("Collect() result error = %v, want status error", r.Err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Collect() failed: %v", err)
+	}
+	for _, s := range summaries {
+		if s.Region != "ok-region" {
+			continue
+		}
+		if got, want := len(s.Durations), 5; got != want {
+			t.Errorf("%s: got %d durations, want %d", s.Region, got, want)
+		}
+		if s.Median() <= 0 {
+			t.Errorf("%s: got median %v, want positive", s.Region, s.Median())
+		}
+	}
+
+	// All pings to a region share a single connection.
+	if got, want := dials.Load(), int32(1); got != want {
+		t.Errorf("Collect() opened %d connections, want %d", got, want)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2010 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+// printPing prints that e is about to be pinged, in verbose output.
+func printPing(e probe.Endpoint) {
+	fmt.Printf("Pinging %q\n", e.Region)
+}
+
+// printResult prints a single result as it completes, depending on the
+// output flags.
+func printResult(r probe.Result) {
+	p := r.Phases
+	if verbose {
+		if r.ColdStart {
+			fmt.Printf("Ping to %q completed in %v (cold start)\n", r.Region, r.Duration)
+		} else {
+			fmt.Printf("Ping to %q completed in %v\n", r.Region, r.Duration)
+		}
+		if showPhases {
+			fmt.Printf("  dns=%v connect=%v tls=%v ttfb=%v server=%v network=%v\n", p.DNS, p.Connect, p.TLS, p.TTFB, p.Server, p.Network)
+		}
+	}
+
+	if csv {
+		fmt.Printf("%v,%v,%v,%v,%v", r.Region, r.Endpoint.URL, r.Duration.Nanoseconds(), r.Err != nil, r.ColdStart)
+		if showPhases {
+			fmt.Printf(",%v,%v,%v,%v,%v,%v", p.DNS.Nanoseconds(), p.Connect.Nanoseconds(), p.TLS.Nanoseconds(), p.TTFB.Nanoseconds(), p.Server.Nanoseconds(), p.Network.Nanoseconds())
+		}
+		if httpVersion != "" {
+			fmt.Print(",", r.Protocol)
+		}
+		fmt.Println()
+	}
+
+	if format == "ndjson" {
+		js := jsonSample{
+			Region:     r.Region,
+			RegionName: r.Endpoint.RegionName,
+			URL:        r.Endpoint.URL,
+			Latency:    r.Duration.Nanoseconds(),
+			Bytes:      r.Bytes,
+			Protocol:   r.Protocol,
+			Addr:       r.Addr,
+			ColdStart:  r.ColdStart,
+			Reordered:  r.Reordered,
+			Phases:     newJSONPhases(p),
+		}
+		if r.Err != nil {
+			js.Error = r.Err.Error()
+		}
+		json.NewEncoder(os.Stdout).Encode(js)
+	}
+}
+
+func reportAll(sorted []*probe.Summary) {
+	tr := tabwriter.NewWriter(os.Stdout, 3, 2, 2, ' ', 0)
+	for i, a := range sorted {
+		if len(statCols) == 1 && statCols[0] == "median" {
+			fmt.Fprintf(tr, "%2d.\t[%v]\t%v", i+1, a.Region, a.Median())
+		} else {
+			fmt.Fprintf(tr, "%2d.\t[%v]", i+1, a.Region)
+			s := a.Stats()
+			for _, c := range statCols {
+				fmt.Fprintf(tr, "\t%v %v", c, statColumns[c](s))
+			}
+		}
+		if transfer() {
+			fmt.Fprintf(tr, "\t%.2f Mbit/s", a.Throughput()/1e6)
+		}
+		if httpVersion != "" {
+			fmt.Fprintf(tr, "\t%v", a.Protocol())
+		}
+		if showPhases {
+			p := a.PhaseMedian()
+			fmt.Fprintf(tr, "\tdns %v\tconnect %v\ttls %v\tttfb %v\tserver %v\tnetwork %v", p.DNS, p.Connect, p.TLS, p.TTFB, p.Server, p.Network)
+		}
+		if oneWay {
+			o := a.OneWay()
+			fmt.Fprintf(tr, "\tup %v\tdown %v\toffset %v", o.Upstream, o.Downstream, o.Offset)
+		}
+		if udp() {
+			fmt.Fprintf(tr, "\tloss %.1f%%", a.LossRate()*100)
+			if a.Reordered > 0 {
+				fmt.Fprintf(tr, "\t(%d reordered)", a.Reordered)
+			}
+		}
+		// Lost packets are reported as loss.
+		if errors := a.Errors - a.Lost; errors > 0 {
+			fmt.Fprintf(tr, "\t(%d errors)", errors)
+		}
+		if a.ColdStarts > 0 {
+			fmt.Fprintf(tr, "\t(%d cold starts)", a.ColdStarts)
+		}
+		fmt.Fprintln(tr)
+	}
+	tr.Flush()
+}
+
+func reportCSV(sorted []*probe.Summary) {
+	fmt.Print("region")
+	for _, c := range statCols {
+		fmt.Print(",", csvHeader(c))
+	}
+	fmt.Print(",errors,cold_starts")
+	if transfer() {
+		fmt.Print(",mbps")
+	}
+	if httpVersion != "" {
+		fmt.Print(",protocol")
+	}
+	if showPhases {
+		fmt.Print(",dns_ns,connect_ns,tls_ns,ttfb_ns,server_ns,network_ns")
+	}
+	if oneWay {
+		fmt.Print(",offset_ns,upstream_ns,downstream_ns")
+	}
+	if udp() {
+		fmt.Print(",loss_pct,reordered")
+	}
+	fmt.Println()
+	for _, a := range sorted {
+		fmt.Print(a.Region)
+		s := a.Stats()
+		for _, c := range statCols {
+			fmt.Print(",", statColumns[c](s).Nanoseconds())
+		}
+		fmt.Print(",", a.Errors, ",", a.ColdStarts)
+		if transfer() {
+			fmt.Printf(",%.2f", a.Throughput()/1e6)
+		}
+		if httpVersion != "" {
+			fmt.Print(",", a.Protocol())
+		}
+		if showPhases {
+			p := a.PhaseMedian()
+			fmt.Printf(",%v,%v,%v,%v,%v,%v", p.DNS.Nanoseconds(), p.Connect.Nanoseconds(), p.TLS.Nanoseconds(), p.TTFB.Nanoseconds(), p.Server.Nanoseconds(), p.Network.Nanoseconds())
+		}
+		if oneWay {
+			o := a.OneWay()
+			fmt.Printf(",%v,%v,%v", o.Offset.Nanoseconds(), o.Upstream.Nanoseconds(), o.Downstream.Nanoseconds())
+		}
+		if udp() {
+			fmt.Printf(",%.1f,%v", a.LossRate()*100, a.Reordered)
+		}
+		fmt.Println()
+	}
+}
+
+func reportJSON(sorted []*probe.Summary) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(newJSONReport(sorted))
+}
+
+func newJSONReport(sorted []*probe.Summary) jsonReport {
+	r := jsonReport{Regions: make([]jsonRegion, 0, len(sorted))}
+	for i, a := range sorted {
+		jr := jsonRegion{
+			Rank:       i + 1,
+			Region:     a.Region,
+			RegionName: a.Endpoint.RegionName,
+			URL:        a.Endpoint.URL,
+			Stats:      newJSONStats(a.Stats()),
+			Phases:     newJSONPhases(a.PhaseMedian()),
+			Samples:    nanoseconds(a.Durations),
+			Protocol:   a.Protocol(),
+			Addrs:      a.Addrs,
+			Errors:     a.Errors,
+			ColdStarts: a.ColdStarts,
+		}
+		if transfer() {
+			jr.Throughput = a.Throughput() / 1e6
+		}
+		if oneWay {
+			o := a.OneWay()
+			jr.OneWay = &jsonOneWay{
+				Offset:     o.Offset.Nanoseconds(),
+				Upstream:   o.Upstream.Nanoseconds(),
+				Downstream: o.Downstream.Nanoseconds(),
+			}
+		}
+		if udp() {
+			jr.UDP = &jsonUDP{
+				Loss:      a.LossRate() * 100,
+				Reordered: a.Reordered,
+			}
+		}
+		r.Regions = append(r.Regions, jr)
+	}
+	return r
+}
+
+// reportBoth prints the cold and warm medians of each region side by
+// side, sorted by the warm median.
+func reportBoth(cold, warm []*probe.Summary) {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]jsonReport{
+			"cold": newJSONReport(cold),
+			"warm": newJSONReport(warm),
+		})
+		return
+	}
+
+	coldByRegion := make(map[string]*probe.Summary, len(cold))
+	for _, c := range cold {
+		coldByRegion[c.Region] = c
+	}
+
+	if csvCum {
+		fmt.Println("region,cold_latency_ns,warm_latency_ns,cold_errors,warm_errors")
+		for _, w := range warm {
+			c := coldByRegion[w.Region]
+			fmt.Printf("%v,%v,%v,%v,%v\n", w.Region, c.Median().Nanoseconds(), w.Median().Nanoseconds(), c.Errors, w.Errors)
+		}
+		return
+	}
+
+	tr := tabwriter.NewWriter(os.Stdout, 3, 2, 2, ' ', 0)
+	for i, w := range warm {
+		c := coldByRegion[w.Region]
+		fmt.Fprintf(tr, "%2d.\t[%v]\tcold %v\twarm %v", i+1, w.Region, c.Median(), w.Median())
+		if errors := c.Errors + w.Errors; errors > 0 {
+			fmt.Fprintf(tr, "\t(%d errors)", errors)
+		}
+		fmt.Fprintln(tr)
+	}
+	tr.Flush()
+}
+
+// reportFamilies prints the IPv4 and IPv6 medians and addresses of each
+// region side by side, sorted by the IPv4 median.
+func reportFamilies(v4, v6 []*probe.Summary) {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]jsonReport{
+			"ipv4": newJSONReport(v4),
+			"ipv6": newJSONReport(v6),
+		})
+		return
+	}
+
+	v6ByRegion := make(map[string]*probe.Summary, len(v6))
+	for _, s := range v6 {
+		v6ByRegion[s.Region] = s
+	}
+	// Rank regions without IPv4 connectivity last.
+	failed := func(s *probe.Summary) int {
+		if s.ErrorRate() == 1 {
+			return 1
+		}
+		return 0
+	}
+	v4 = slices.Clone(v4)
+	slices.SortStableFunc(v4, func(a, b *probe.Summary) int {
+		return failed(a) - failed(b)
+	})
+
+	if csvCum {
+		fmt.Println("region,ipv4_latency_ns,ipv6_latency_ns,ipv4_errors,ipv6_errors,ipv4_addrs,ipv6_addrs")
+		for _, a := range v4 {
+			b := v6ByRegion[a.Region]
+			fmt.Printf("%v,%v,%v,%v,%v,%v,%v\n", a.Region, familyMedianNS(a), familyMedianNS(b), a.Errors, b.Errors, strings.Join(a.Addrs, " "), strings.Join(b.Addrs, " "))
+		}
+		return
+	}
+
+	tr := tabwriter.NewWriter(os.Stdout, 3, 2, 2, ' ', 0)
+	for i, a := range v4 {
+		b := v6ByRegion[a.Region]
+		fmt.Fprintf(tr, "%2d.\t[%v]\tipv4 %v\t%v\tipv6 %v\t%v", i+1, a.Region, familyMedian(a), addrs(a), familyMedian(b), addrs(b))
+		if errors := a.Errors + b.Errors; errors > 0 {
+			fmt.Fprintf(tr, "\t(%d errors)", errors)
+		}
+		fmt.Fprintln(tr)
+	}
+	tr.Flush()
+}
+
+// familyMedian returns the median of s, or "-" if all pings failed, e.g.
+// because the region has no address of the family.
+func familyMedian(s *probe.Summary) string {
+	if s.ErrorRate() == 1 {
+		return "-"
+	}
+	return s.Median().String()
+}
+
+// familyMedianNS is familyMedian in nanoseconds, or empty.
+func familyMedianNS(s *probe.Summary) string {
+	if s.ErrorRate() == 1 {
+		return ""
+	}
+	return strconv.FormatInt(s.Median().Nanoseconds(), 10)
+}
+
+// addrs returns the addresses pinged in s, or "-" if there are none.
+func addrs(s *probe.Summary) string {
+	if len(s.Addrs) == 0 {
+		return "-"
+	}
+	return strings.Join(s.Addrs, ",")
+}
+
+// transfer reports whether throughput is measured instead of latency.
+func transfer() bool {
+	return download > 0 || upload > 0
+}
+
+// udp reports whether packet loss is measured along with latency.
+func udp() bool {
+	return proto == "udp"
+}
+
+// reportTop prints the n best regions, skipping global and regions that
+// couldn't be reached.
+func reportTop(sorted []*probe.Summary, n int) {
+	for _, a := range sorted {
+		if n == 0 {
+			break
+		}
+		if a.Region == "global" || a.Failed() {
+			continue
+		}
+		if topLatency {
+			fmt.Println(a.Region, a.Median())
+		} else {
+			fmt.Println(a.Region)
+		}
+		n--
+	}
+}
+
+func reportRegion(sorted []*probe.Summary) {
+	fmt.Println(sorted[0].Median())
+}
@@ -0,0 +1,196 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/config"
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+// Exit codes.
+const (
+	exitThreshold = 1 // a -max-* threshold was breached
+	exitConfig    = 2 // invalid flags or endpoints
+	exitProbe     = 3 // a region could not be reached
+)
+
+// thresholdFlag is a -max-* flag. It is a comma-separated list of a limit
+// for all regions and limits for individual regions, e.g.
+// "80ms,us-central1=50ms".
+type thresholdFlag struct {
+	parse  func(string) (float64, error)
+	format func(float64) string
+
+	all     float64
+	allSet  bool
+	regions map[string]float64
+}
+
+func (t *thresholdFlag) String() string {
+	if t == nil || t.format == nil {
+		return ""
+	}
+	var l []string
+	if t.allSet {
+		l = append(l, t.format(t.all))
+	}
+	for r, v := range t.regions {
+		l = append(l, r+"="+t.format(v))
+	}
+	sort.Strings(l)
+	return strings.Join(l, ",")
+}
+
+func (t *thresholdFlag) Set(s string) error {
+	for _, e := range config.SplitList(s) {
+		r, v := "", e
+		if i := strings.Index(e, "="); i >= 0 {
+			r, v = e[:i], e[i+1:]
+		}
+		limit, err := t.parse(v)
+		if err != nil {
+			return err
+		}
+		if r == "" {
+			t.all, t.allSet = limit, true
+			continue
+		}
+		if t.regions == nil {
+			t.regions = make(map[string]float64)
+		}
+		t.regions[r] = limit
+	}
+	return nil
+}
+
+// limit returns the limit that applies to region, if any.
+func (t *thresholdFlag) limit(region string) (float64, bool) {
+	if v, ok := t.regions[region]; ok {
+		return v, true
+	}
+	return t.all, t.allSet
+}
+
+func (t *thresholdFlag) isSet() bool {
+	return t.allSet || len(t.regions) > 0
+}
+
+func newDurationThreshold() *thresholdFlag {
+	return &thresholdFlag{
+		parse: func(s string) (float64, error) {
+			d, err := time.ParseDuration(s)
+			return float64(d), err
+		},
+		format: func(v float64) string { return time.Duration(v).String() },
+	}
+}
+
+// newRateThreshold returns a threshold of a ratio, given either as a
+// fraction ("0.05") or a percentage ("5%").
+func newRateThreshold() *thresholdFlag {
+	return &thresholdFlag{
+		parse: func(s string) (float64, error) {
+			if p := strings.TrimSuffix(s, "%"); p != s {
+				v, err := strconv.ParseFloat(p, 64)
+				return v / 100, err
+			}
+			return strconv.ParseFloat(s, 64)
+		},
+		format: func(v float64) string { return fmt.Sprintf("%g%%", v*100) },
+	}
+}
+
+var (
+	maxMedian    = newDurationThreshold()
+	maxP95       = newDurationThreshold()
+	maxErrorRate = newRateThreshold()
+)
+
+// thresholds are the checks made by checkThresholds.
+var thresholds = []struct {
+	name  string
+	flag  *thresholdFlag
+	value func(s *probe.Summary) float64
+}{
+	{"median", maxMedian, func(s *probe.Summary) float64 { return float64(s.Median()) }},
+	{"p95", maxP95, func(s *probe.Summary) float64 { return float64(s.Stats().P95) }},
+	{"error rate", maxErrorRate, func(s *probe.Summary) float64 { return s.ErrorRate() }},
+}
+
+// thresholdsSet reports whether any -max-* flag is set.
+func thresholdsSet() bool {
+	for _, t := range thresholds {
+		if t.flag.isSet() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkThresholdRegions returns an error if a -max-* flag names a region
+// that is not in em, the endpoints left after -r, -include and -exclude.
+func checkThresholdRegions(em map[string]config.Endpoint) error {
+	for _, t := range thresholds {
+		for r := range t.flag.regions {
+			if _, ok := em[r]; !ok {
+				return fmt.Errorf("region %q has a -max-* limit but is not pinged", r)
+			}
+		}
+	}
+	return nil
+}
+
+// checkThresholds prints the regions that breach a -max-* threshold or
+// could not be reached to stderr, and returns the exit code of the
+// process. A non-empty run, e.g. "cold", is printed after the region.
+// exitProbe takes precedence over exitThreshold, so the codes of several
+// runs combine with max.
+func checkThresholds(sorted []*probe.Summary, run string) int {
+	if !thresholdsSet() {
+		return 0
+	}
+	code := 0
+	for _, s := range sorted {
+		name := s.Region
+		if run != "" {
+			name += " (" + run + ")"
+		}
+		if s.Failed() {
+			fmt.Fprintf(os.Stderr, "%s: all pings failed\n", name)
+			code = exitProbe
+			continue
+		}
+		for _, t := range thresholds {
+			limit, ok := t.flag.limit(s.Region)
+			if !ok {
+				continue
+			}
+			if v := t.value(s); v > limit {
+				fmt.Fprintf(os.Stderr, "%s: %s %s exceeds %s\n", name, t.name, t.flag.format(v), t.flag.format(limit))
+				if code == 0 {
+					code = exitThreshold
+				}
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/internal/config"
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+func TestThresholdFlag(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		flag    *thresholdFlag
+		value   string
+		region  string
+		want    float64
+		wantSet bool
+		wantErr bool
+	}{
+		{"duration", newDurationThreshold(), "80ms", "us-east1", float64(80 * time.Millisecond), true, false},
+		{"region override", newDurationThreshold(), "80ms,us-east1=50ms", "us-east1", float64(50 * time.Millisecond), true, false},
+		{"other region", newDurationThreshold(), "80ms,us-east1=50ms", "us-west1", float64(80 * time.Millisecond), true, false},
+		{"region only", newDurationThreshold(), "us-east1=50ms", "us-west1", 0, false, false},
+		{"bad duration", newDurationThreshold(), "80", "", 0, false, true},
+		{"fraction", newRateThreshold(), "0.05", "us-east1", 0.05, true, false},
+		{"percentage", newRateThreshold(), "5%", "us-east1", 0.05, true, false},
+		{"rate override", newRateThreshold(), "5%,us-east1=0.5", "us-east1", 0.5, true, false},
+		{"bad rate", newRateThreshold(), "five%", "", 0, false, true},
+	}
+	for _, tc := range testCases {
+		err := tc.flag.Set(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: Set(%q) succeeded, want error", tc.name, tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Set(%q) failed: %v", tc.name, tc.value, err)
+			continue
+		}
+		got, set := tc.flag.limit(tc.region)
+		if got != tc.want || set != tc.wantSet {
+			t.Errorf("%s: limit(%q) = %v, %v, want %v, %v", tc.name, tc.region, got, set, tc.want, tc.wantSet)
+		}
+	}
+}
+
+func TestRateThresholdString(t *testing.T) {
+	t.Parallel()
+
+	f := newRateThreshold()
+	if err := f.Set("0.05,us-east1=50%"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.String(), "5%,us-east1=50%"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+// setThreshold sets a -max-* flag for the duration of the test.
+func setThreshold(t *testing.T, f *thresholdFlag, value string) {
+	t.Helper()
+	saved := *f
+	t.Cleanup(func() { *f = saved })
+	if err := f.Set(value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCheckThresholds sets the global -max-* flags, so it isn't parallel.
+func TestCheckThresholds(t *testing.T) {
+	ok := &probe.Summary{Region: "ok", Durations: []time.Duration{10 * time.Millisecond}}
+	slow := &probe.Summary{Region: "slow", Durations: []time.Duration{100 * time.Millisecond}}
+	dead := &probe.Summary{Region: "dead", Durations: []time.Duration{time.Millisecond}, Errors: 1}
+
+	if got := checkThresholds([]*probe.Summary{slow, dead}, ""); got != 0 {
+		t.Errorf("no thresholds: checkThresholds() = %d, want 0", got)
+	}
+
+	setThreshold(t, maxMedian, "50ms")
+	testCases := []struct {
+		name      string
+		summaries []*probe.Summary
+		want      int
+	}{
+		{"within limits", []*probe.Summary{ok}, 0},
+		{"breach", []*probe.Summary{ok, slow}, exitThreshold},
+		{"unreachable", []*probe.Summary{ok, dead}, exitProbe},
+		{"unreachable before breach", []*probe.Summary{dead, slow}, exitProbe},
+		{"breach before unreachable", []*probe.Summary{slow, dead}, exitProbe},
+	}
+	for _, tc := range testCases {
+		if got := checkThresholds(tc.summaries, ""); got != tc.want {
+			t.Errorf("%s: checkThresholds() = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestCheckThresholdRegions sets the global -max-* flags, so it isn't
+// parallel.
+func TestCheckThresholdRegions(t *testing.T) {
+	setThreshold(t, maxMedian, "80ms")
+	setThreshold(t, maxP95, "us-east1=100ms")
+
+	testCases := []struct {
+		name    string
+		em      map[string]config.Endpoint
+		wantErr bool
+	}{
+		{"pinged", map[string]config.Endpoint{"us-east1": {}, "us-west1": {}}, false},
+		// e.g. with -exclude us-east1.
+		{"filtered out", map[string]config.Endpoint{"us-west1": {}}, true},
+	}
+	for _, tc := range testCases {
+		if err := checkThresholdRegions(tc.em); (err != nil) != tc.wantErr {
+			t.Errorf("%s: checkThresholdRegions() = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+// statColumns are the values that can be selected with -stats.
+var statColumns = map[string]func(s probe.Stats) time.Duration{
+	"min":    func(s probe.Stats) time.Duration { return s.Min },
+	"max":    func(s probe.Stats) time.Duration { return s.Max },
+	"mean":   func(s probe.Stats) time.Duration { return s.Mean },
+	"stddev": func(s probe.Stats) time.Duration { return s.StdDev },
+	"median": func(s probe.Stats) time.Duration { return s.P50 },
+	"p50":    func(s probe.Stats) time.Duration { return s.P50 },
+	"p90":    func(s probe.Stats) time.Duration { return s.P90 },
+	"p95":    func(s probe.Stats) time.Duration { return s.P95 },
+	"p99":    func(s probe.Stats) time.Duration { return s.P99 },
+	"jitter": func(s probe.Stats) time.Duration { return s.Jitter },
+}
+
+// parseStatColumns parses a comma-separated list of -stats columns.
+func parseStatColumns(s string) ([]string, error) {
+	var cols []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if _, ok := statColumns[c]; !ok {
+			return nil, fmt.Errorf("unknown stat %q", c)
+		}
+		cols = append(cols, c)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no stats selected")
+	}
+	return cols, nil
+}
+
+// csvHeader returns the CSV column name of a stat. The median keeps its
+// historical latency_ns name.
+func csvHeader(col string) string {
+	if col == "median" {
+		return "latency_ns"
+	}
+	return col + "_ns"
+}
@@ -27,7 +27,8 @@ resource "google_storage_bucket_object" "endpoints_config" {
           {
             URL        = google_cloud_run_service.regions[k].status[0].url,
             RegionName = v,
-            Region     = k
+            Region     = k,
+            GRPCURL    = google_cloud_run_service.grpc[k].status[0].url
           }
         ]
       ),
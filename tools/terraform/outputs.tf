@@ -20,6 +20,14 @@ output "services" {
   }
 }
 
+// Print each gRPC service URL.
+output "grpc_services" {
+  value = {
+    for svc in google_cloud_run_service.grpc :
+    svc.name => svc.status[0].url
+  }
+}
+
 // Print global LB IP address.
 output "global" {
   value = google_compute_global_address.global.address
@@ -68,6 +68,65 @@ resource "google_cloud_run_service" "regions" {
   ]
 }
 
+// Deploy a second Cloud Run service in each region with end-to-end HTTP/2
+// (h2c), which gRPC needs. The services above keep HTTP/1.1 to the
+// container for WebSockets and the other routes.
+resource "google_cloud_run_service" "grpc" {
+  for_each = local.regions
+  name     = "${each.key}-grpc"
+  location = each.key
+
+  template {
+    metadata {
+      annotations = {
+        "autoscaling.knative.dev/maxScale" = "3" // Control costs.
+        "run.googleapis.com/launch-stage"  = "BETA"
+      }
+    }
+    spec {
+      service_account_name = google_service_account.minimal.email
+      containers {
+        image = local.image
+        ports {
+          name           = "h2c"
+          container_port = 8080
+        }
+        env {
+          name  = "REGION"
+          value = each.key
+        }
+      }
+    }
+  }
+  lifecycle {
+    ignore_changes = [
+      // This gets added by the Cloud Run API post deploy and causes diffs, can be ignored...
+      template[0].metadata[0].annotations["run.googleapis.com/sandbox"],
+    ]
+  }
+  traffic {
+    percent         = 100
+    latest_revision = true
+  }
+
+  depends_on = [
+    google_project_service.run,
+    google_project_service.gcr,
+  ]
+}
+
+// Make each gRPC Cloud Run service invokable by unauthenticated users.
+resource "google_cloud_run_service_iam_member" "grpcAllUsers" {
+  for_each = google_cloud_run_service.grpc
+
+  service  = google_cloud_run_service.grpc[each.key].name
+  location = each.key
+  role     = "roles/run.invoker"
+  member   = "allUsers"
+
+  depends_on = [google_cloud_run_service.grpc]
+}
+
 // Make each Cloud Run service invokable by unauthenticated users.
 resource "google_cloud_run_service_iam_member" "allUsers" {
   for_each = google_cloud_run_service.regions
@@ -0,0 +1,156 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+const (
+	// watchWindow is the number of recent samples per region that the
+	// stats and errors are computed over in watch mode.
+	watchWindow = 60
+	// sparkWidth is the number of recent samples drawn in the sparkline.
+	sparkWidth = 20
+)
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// watch pings every endpoint once per interval until ctx is done,
+// redrawing the report after each round.
+func watch(ctx context.Context, p *probe.Prober, em map[string]probe.Endpoint, interval time.Duration) {
+	windows := make(map[string][]probe.Result)
+	repeat(ctx, interval, func(round int) error {
+		err := p.Run(ctx, em, func(r probe.Result) {
+			windows[r.Region] = addWindowed(windows[r.Region], r)
+		})
+		if err != nil {
+			return err
+		}
+		all := make([]*probe.Summary, 0, len(windows))
+		for _, w := range windows {
+			all = append(all, summarize(w))
+		}
+		drawWatch(all, round, interval)
+		return nil
+	})
+}
+
+// addWindowed appends r to the results w of a region, keeping the last
+// watchWindow results.
+func addWindowed(w []probe.Result, r probe.Result) []probe.Result {
+	w = append(w, r)
+	if n := len(w); n > watchWindow {
+		w = w[n-watchWindow:]
+	}
+	return w
+}
+
+// summarize returns the summary of the results w of a region. It is
+// rebuilt from the window, so that errors and cold starts leave it along
+// with the durations.
+func summarize(w []probe.Result) *probe.Summary {
+	s := &probe.Summary{
+		Region:            w[0].Region,
+		Endpoint:          w[0].Endpoint,
+		IncludeColdStarts: coldStarts,
+	}
+	for _, r := range w {
+		s.Add(r)
+	}
+	return s
+}
+
+// repeat calls fn once per interval, counting rounds from 1, until ctx is
+// done or fn returns an error.
+func repeat(ctx context.Context, interval time.Duration, fn func(round int) error) {
+	for round := 1; ; round++ {
+		start := time.Now()
+		if err := fn(round); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval - time.Since(start)):
+		}
+	}
+}
+
+// drawWatch clears the terminal and prints the current state.
+func drawWatch(all []*probe.Summary, round int, interval time.Duration) {
+	probe.Sort(all)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "gcping: round %d, every %v. Press Ctrl-C to exit.\n\n", round, interval)
+	tr := tabwriter.NewWriter(&b, 3, 2, 2, ' ', 0)
+	fmt.Fprintln(tr, "\tREGION\tNAME\tLAST\tMEDIAN\tP95\tERRORS\tRECENT")
+	for i, s := range all {
+		if len(s.Durations) == 0 {
+			// Only cold starts so far.
+			fmt.Fprintf(tr, "%2d.\t[%v]\t%v\t-\t-\t-\t%d\t\n", i+1, s.Region, s.Endpoint.RegionName, s.Errors)
+			continue
+		}
+		st := s.Stats()
+		fmt.Fprintf(tr, "%2d.\t[%v]\t%v\t%v\t%v\t%v\t%d\t%s\n",
+			i+1, s.Region, s.Endpoint.RegionName,
+			s.Durations[len(s.Durations)-1], st.P50, st.P95, s.Errors,
+			sparkline(s.Durations))
+	}
+	tr.Flush()
+
+	// Move the cursor home and clear the screen before drawing.
+	fmt.Fprint(os.Stdout, "\033[H\033[2J")
+	os.Stdout.Write(b.Bytes())
+}
+
+// sparkline draws the last sparkWidth samples of d scaled between their
+// minimum and maximum.
+func sparkline(d []time.Duration) string {
+	if len(d) > sparkWidth {
+		d = d[len(d)-sparkWidth:]
+	}
+	if len(d) == 0 {
+		return ""
+	}
+	lo, hi := d[0], d[0]
+	for _, v := range d {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+
+	var sb strings.Builder
+	for _, v := range d {
+		i := 0
+		if hi > lo {
+			i = int(int64(v-lo) * int64(len(sparkChars)-1) / int64(hi-lo))
+		}
+		sb.WriteRune(sparkChars[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/gcping/probe"
+)
+
+func TestWatchWindow(t *testing.T) {
+	t.Parallel()
+
+	failed := probe.Result{Region: "r", Duration: time.Second, Err: errors.New("timeout")}
+	ok := probe.Result{Region: "r", Duration: time.Millisecond}
+	cold := probe.Result{Region: "r", Duration: time.Second, ColdStart: true}
+
+	// run is n results in a row.
+	type run struct {
+		n int
+		r probe.Result
+	}
+	testCases := []struct {
+		name       string
+		runs       []run
+		wantErrors int
+		wantCold   int
+		wantFailed bool
+	}{
+		{"all failed", []run{{watchWindow, failed}}, watchWindow, 0, true},
+		{"recovered", []run{{watchWindow, failed}, {watchWindow, ok}}, 0, 0, false},
+		{"more failures than the window", []run{{2 * watchWindow, failed}}, watchWindow, 0, true},
+		{"half recovered", []run{{watchWindow, failed}, {watchWindow / 2, ok}}, watchWindow / 2, 0, false},
+		{"cold starts leave", []run{{10, cold}, {watchWindow, ok}}, 0, 0, false},
+	}
+	for _, tc := range testCases {
+		var w []probe.Result
+		for _, run := range tc.runs {
+			for range run.n {
+				w = addWindowed(w, run.r)
+			}
+		}
+		s := summarize(w)
+		if s.Errors != tc.wantErrors || s.ColdStarts != tc.wantCold || s.Failed() != tc.wantFailed {
+			t.Errorf("%s: got %d errors, %d cold starts, Failed() %v, want %d, %d, %v", tc.name, s.Errors, s.ColdStarts, s.Failed(), tc.wantErrors, tc.wantCold, tc.wantFailed)
+		}
+		if r := s.ErrorRate(); r > 1 {
+			t.Errorf("%s: ErrorRate() = %v, want at most 1", tc.name, r)
+		}
+	}
+}